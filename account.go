@@ -0,0 +1,112 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// handleExportMe returns everything stored about the caller as a JSON file,
+// or with ?format=csv a zip holding one CSV per table.
+func handleExportMe(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromRequest(r)
+	if user == nil {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "csv" {
+		http.Error(w, "Format must be json or csv", http.StatusBadRequest)
+		return
+	}
+
+	tables, err := store.ExportUser(user.ID)
+	if err != nil {
+		log.Printf("GET /api/me/export: user %d: %v", user.ID, err)
+		http.Error(w, "Failed to export data", http.StatusInternalServerError)
+		return
+	}
+	audit(r, user.ID, "account.export", user.ID, nil, map[string]interface{}{"format": format})
+
+	now := time.Now().UTC()
+	filename := fmt.Sprintf("wordle-six-export-%d-%s", user.ID, now.Format("20060102"))
+
+	if format == "csv" {
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.zip"`)
+		zw := zip.NewWriter(w)
+		for _, t := range tables {
+			f, err := zw.Create(t.Name + ".csv")
+			if err != nil {
+				log.Printf("GET /api/me/export: user %d: %v", user.ID, err)
+				return
+			}
+			cw := csv.NewWriter(f)
+			cw.Write(t.Columns)
+			for _, row := range t.Rows {
+				record := make([]string, len(row))
+				for i, v := range row {
+					if v != nil {
+						record[i] = fmt.Sprint(v)
+					}
+				}
+				cw.Write(record)
+			}
+			cw.Flush()
+		}
+		zw.Close()
+		return
+	}
+
+	export := map[string]interface{}{"exported_at": now.Format(time.RFC3339)}
+	for _, t := range tables {
+		rows := []map[string]interface{}{}
+		for _, row := range t.Rows {
+			m := map[string]interface{}{}
+			for i, col := range t.Columns {
+				m[col] = row[i]
+			}
+			rows = append(rows, m)
+		}
+		export[t.Name] = rows
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.json"`)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(export)
+}
+
+// handleDeleteMe erases the caller's account through store.DeleteUser, which
+// removes everything held about them in one transaction and anonymises the
+// user, ending all of their sessions.
+func handleDeleteMe(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromRequest(r)
+	if user == nil {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	if err := store.DeleteUser(user.ID); err != nil {
+		log.Printf("DELETE /api/me: user %d: %v", user.ID, err)
+		http.Error(w, "Failed to delete account", http.StatusInternalServerError)
+		return
+	}
+	invalidateLeaderboard()
+	log.Printf("DELETE /api/me: deleted user %d", user.ID)
+	// No request, so no IP: nothing identifying is kept once they're gone
+	audit(nil, user.ID, "account.delete", user.ID, nil, nil)
+
+	clearSessionCookie(w)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"ok":true}`))
+}
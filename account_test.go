@@ -0,0 +1,47 @@
+package main
+
+import "testing"
+
+// TestDeleteUser checks that deleting an account clears everything tied to
+// it and hands its groups on to the remaining members.
+func TestDeleteUser(t *testing.T) {
+	useTestDB(t)
+
+	for _, q := range []string{
+		"INSERT INTO users (id, provider, provider_id, display_name) VALUES (1, 'github', '1', 'Leaving'), (2, 'github', '2', 'Staying')",
+		"INSERT INTO player_groups (id, name, invite_code, created_by) VALUES (1, 'Shared', 'aaa', 1), (2, 'Solo', 'bbb', 1)",
+		"INSERT INTO group_members (group_id, user_id, is_admin) VALUES (1, 1, TRUE), (1, 2, FALSE), (2, 1, TRUE)",
+		"INSERT INTO friendships (requester_id, addressee_id, accepted) VALUES (2, 1, TRUE)",
+		"INSERT INTO cheat_flags (user_id, endpoint, reason) VALUES (1, '/api/guess', 'tz_drift')",
+		"INSERT INTO audit_log (created_at, actor_id, action, target_id, after_json, ip) VALUES ('2024-01-01T00:00:00Z', 1, 'name.set', 1, '{\"custom_name\":\"Leaving\"}', '203.0.113.1')",
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+	}
+
+	if err := store.DeleteUser(1); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		query string
+		want  int
+	}{
+		{"SELECT COUNT(*) FROM group_members WHERE user_id = 1", 0},
+		{"SELECT COUNT(*) FROM group_members WHERE group_id = 1 AND user_id = 2 AND is_admin", 1},
+		{"SELECT COUNT(*) FROM player_groups WHERE id = 2", 0},
+		{"SELECT COUNT(*) FROM friendships", 0},
+		{"SELECT COUNT(*) FROM cheat_flags", 0},
+		{"SELECT COUNT(*) FROM audit_log WHERE after_json IS NOT NULL OR ip != ''", 0},
+		{"SELECT COUNT(*) FROM users WHERE id = 1 AND provider = 'deleted' AND deleted_at IS NOT NULL", 1},
+	} {
+		var got int
+		if err := db.QueryRow(c.query).Scan(&got); err != nil {
+			t.Fatalf("%s: %v", c.query, err)
+		}
+		if got != c.want {
+			t.Errorf("%s = %d, want %d", c.query, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// How much history the admin user detail includes.
+const (
+	detailResults    = 30
+	detailTzEvents   = 20
+	detailCheatFlags = 50
+)
+
+// handleListUsers pages through users for staff. ?q= searches by user ID,
+// name or provider account ID; ?provider= and ?banned=true|false filter;
+// ?sort=id|joined|games with ?order=asc|desc orders (joined and games default
+// to newest and most first).
+func handleListUsers(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	f := UserFilter{
+		Query:    q.Get("q"),
+		Provider: q.Get("provider"),
+		Sort:     q.Get("sort"),
+		Limit:    100,
+	}
+	if l, err := strconv.Atoi(q.Get("limit")); err == nil && l > 0 && l <= 500 {
+		f.Limit = l
+	}
+	if o, err := strconv.Atoi(q.Get("offset")); err == nil && o > 0 {
+		f.Offset = o
+	}
+	if v := q.Get("banned"); v != "" {
+		banned, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "banned must be true or false", http.StatusBadRequest)
+			return
+		}
+		f.Banned = &banned
+	}
+	if f.Sort == "" {
+		f.Sort = "id"
+	}
+	if _, ok := userSortColumns[f.Sort]; !ok {
+		http.Error(w, "sort must be id, joined or games", http.StatusBadRequest)
+		return
+	}
+	switch q.Get("order") {
+	case "":
+		f.Desc = f.Sort != "id"
+	case "asc":
+	case "desc":
+		f.Desc = true
+	default:
+		http.Error(w, "order must be asc or desc", http.StatusBadRequest)
+		return
+	}
+
+	users, total, err := store.ListUsers(f)
+	if err != nil {
+		log.Printf("GET /api/admin/users: %v", err)
+		http.Error(w, "Failed to query users", http.StatusInternalServerError)
+		return
+	}
+
+	var nextOffset *int
+	if f.Offset+f.Limit < total {
+		next := f.Offset + f.Limit
+		nextOffset = &next
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"users":       users,
+		"total":       total,
+		"offset":      f.Offset,
+		"next_offset": nextOffset,
+	})
+}
+
+// handleGetUserDetail returns everything staff need to review one user: their
+// account, linked identities, stats, recent results, voided days, recent
+// timezone events and cheat flags.
+func handleGetUserDetail(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var u UserSummary
+	var createdAt, deletedAt sql.NullString
+	err = db.QueryRow(`
+		SELECT u.id, u.provider, u.display_name, COALESCE(u.custom_name, ''), COALESCE(u.avatar_url, ''),
+			u.banned, u.role, u.created_at, u.deleted_at, COALESCE(st.played, 0)
+		FROM users u
+		LEFT JOIN user_stats st ON st.user_id = u.id
+		WHERE u.id = ?
+	`, userID).Scan(&u.ID, &u.Provider, &u.DisplayName, &u.CustomName, &u.AvatarURL, &u.Banned, &u.Role, &createdAt, &deletedAt, &u.GamesPlayed)
+	if err == sql.ErrNoRows {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("GET /api/admin/users/%d: %v", userID, err)
+		http.Error(w, "Failed to load user", http.StatusInternalServerError)
+		return
+	}
+	u.CreatedAt, u.DeletedAt = createdAt.String, deletedAt.String
+
+	identities, err := store.ListIdentities(userID)
+	var stats *UserStats
+	if err == nil {
+		stats, err = store.GetUserStats(userID)
+		if err == sql.ErrNoRows {
+			err = nil
+		}
+	}
+	results := []GameResult{}
+	if err == nil {
+		err = scanEach(`
+			SELECT date, won, guesses, hard_mode FROM game_results
+			WHERE user_id = ? ORDER BY date DESC LIMIT ?
+		`, []interface{}{userID, detailResults}, func(rows *sql.Rows) error {
+			var res GameResult
+			err := rows.Scan(&res.Date, &res.Won, &res.Guesses, &res.HardMode)
+			results = append(results, res)
+			return err
+		})
+	}
+	voided := []string{}
+	if err == nil {
+		err = scanEach("SELECT date FROM voided_results WHERE user_id = ? ORDER BY date DESC",
+			[]interface{}{userID}, func(rows *sql.Rows) error {
+				var date string
+				err := rows.Scan(&date)
+				voided = append(voided, date)
+				return err
+			})
+	}
+	tzEvents := []map[string]interface{}{}
+	if err == nil {
+		err = scanEach(`
+			SELECT server_utc, client_time, tz_offset, ip, endpoint FROM tz_events
+			WHERE user_id = ? ORDER BY server_utc DESC LIMIT ?
+		`, []interface{}{userID, detailTzEvents}, func(rows *sql.Rows) error {
+			var serverUTC, clientTime, ip, endpoint string
+			var tzOffset int
+			err := rows.Scan(&serverUTC, &clientTime, &tzOffset, &ip, &endpoint)
+			tzEvents = append(tzEvents, map[string]interface{}{
+				"server_utc": serverUTC, "client_time": clientTime, "tz_offset": tzOffset, "ip": ip, "endpoint": endpoint,
+			})
+			return err
+		})
+	}
+	cheatFlags := []map[string]interface{}{}
+	if err == nil {
+		err = scanEach(`
+			SELECT COALESCE(date, ''), endpoint, reason, created_at FROM cheat_flags
+			WHERE user_id = ? ORDER BY created_at DESC, id DESC LIMIT ?
+		`, []interface{}{userID, detailCheatFlags}, func(rows *sql.Rows) error {
+			var date, endpoint, reason string
+			var createdAt sql.NullString
+			err := rows.Scan(&date, &endpoint, &reason, &createdAt)
+			cheatFlags = append(cheatFlags, map[string]interface{}{
+				"date": date, "endpoint": endpoint, "reason": reason, "created_at": createdAt.String,
+			})
+			return err
+		})
+	}
+	if err != nil {
+		log.Printf("GET /api/admin/users/%d: %v", userID, err)
+		http.Error(w, "Failed to load user", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"user":           u,
+		"identities":     identities,
+		"stats":          stats,
+		"recent_results": results,
+		"voided_results": voided,
+		"tz_events":      tzEvents,
+		"cheat_flags":    cheatFlags,
+	})
+}
+
+// scanEach runs a query and calls scan for each row.
+func scanEach(query string, args []interface{}, scan func(rows *sql.Rows) error) error {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// audit records an action in audit_log. actorID is whoever took the action,
+// or 0 for the command line; targetID is the user it was taken on, or 0.
+// before and after are marshalled to JSON. A failed write is logged but
+// never undoes the action.
+func audit(r *http.Request, actorID int64, action string, targetID int64, before, after interface{}) {
+	ip := ""
+	if r != nil {
+		ip = getClientIP(r)
+	}
+	_, err := db.Exec(`
+		INSERT INTO audit_log (created_at, actor_id, action, target_id, before_json, after_json, ip)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, time.Now().UTC().Format(time.RFC3339), nullID(actorID), action, nullID(targetID), auditJSON(before), auditJSON(after), ip)
+	if err != nil {
+		log.Printf("Audit: failed to record %s by %d on %d: %v", action, actorID, targetID, err)
+	}
+}
+
+func nullID(id int64) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+func auditJSON(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return string(b)
+}
+
+// scrubAudit drops what audit_log holds about a deleted user: the before and
+// after values of actions taken on them, and the IPs of their own actions.
+// The entries themselves stay so the trail has no gaps.
+func scrubAudit(q querier, userID int64) error {
+	_, err := q.Exec("UPDATE audit_log SET before_json = NULL, after_json = NULL WHERE target_id = ?", userID)
+	if err == nil {
+		_, err = q.Exec("UPDATE audit_log SET ip = '' WHERE actor_id = ?", userID)
+	}
+	return err
+}
+
+// AuditEntry is a row of audit_log as returned by GET /api/admin/audit.
+type AuditEntry struct {
+	ID         int64           `json:"id"`
+	CreatedAt  string          `json:"created_at"`
+	ActorID    *int64          `json:"actor_id"`
+	ActorName  string          `json:"actor_name,omitempty"`
+	Action     string          `json:"action"`
+	TargetID   *int64          `json:"target_id"`
+	TargetName string          `json:"target_name,omitempty"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	IP         string          `json:"ip,omitempty"`
+}
+
+// handleListAudit pages through audit_log, newest first. It can be filtered
+// by ?actor_id=, ?target_id=, ?action= (exact, or a prefix ending in "."
+// such as "user.") and a ?from=&to= date range.
+func handleListAudit(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	limit := 50
+	if l, err := strconv.Atoi(q.Get("limit")); err == nil && l > 0 && l <= 200 {
+		limit = l
+	}
+	offset := 0
+	if o, err := strconv.Atoi(q.Get("offset")); err == nil && o > 0 {
+		offset = o
+	}
+
+	conds := []string{}
+	args := []interface{}{}
+	for _, param := range []string{"actor_id", "target_id"} {
+		if v := q.Get(param); v != "" {
+			id, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				http.Error(w, "Invalid "+param, http.StatusBadRequest)
+				return
+			}
+			conds = append(conds, "a."+param+" = ?")
+			args = append(args, id)
+		}
+	}
+	if action := q.Get("action"); strings.HasSuffix(action, ".") {
+		conds = append(conds, `a.action LIKE ? ESCAPE '\'`)
+		args = append(args, likeEscaper.Replace(action)+"%")
+	} else if action != "" {
+		conds = append(conds, "a.action = ?")
+		args = append(args, action)
+	}
+	if from := q.Get("from"); from != "" {
+		t, err := time.Parse(dateLayout, from)
+		if err != nil {
+			http.Error(w, "Invalid from date", http.StatusBadRequest)
+			return
+		}
+		conds = append(conds, "a.created_at >= ?")
+		args = append(args, t.Format(time.RFC3339))
+	}
+	if to := q.Get("to"); to != "" {
+		t, err := time.Parse(dateLayout, to)
+		if err != nil {
+			http.Error(w, "Invalid to date", http.StatusBadRequest)
+			return
+		}
+		conds = append(conds, "a.created_at < ?")
+		args = append(args, t.AddDate(0, 0, 1).Format(time.RFC3339))
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = "WHERE " + strings.Join(conds, " AND ")
+	}
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM audit_log a "+where, args...).Scan(&total); err != nil {
+		log.Printf("GET /api/admin/audit: %v", err)
+		http.Error(w, "Failed to query audit log", http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT a.id, a.created_at, a.actor_id, COALESCE(actor.custom_name, actor.display_name, ''),
+			a.action, a.target_id, COALESCE(target.custom_name, target.display_name, ''),
+			a.before_json, a.after_json, a.ip
+		FROM audit_log a
+		LEFT JOIN users actor ON actor.id = a.actor_id
+		LEFT JOIN users target ON target.id = a.target_id
+		`+where+`
+		ORDER BY a.id DESC
+		LIMIT ? OFFSET ?
+	`, append(args, limit, offset)...)
+	if err != nil {
+		log.Printf("GET /api/admin/audit: %v", err)
+		http.Error(w, "Failed to query audit log", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		var before, after sql.NullString
+		if err := rows.Scan(&e.ID, &e.CreatedAt, &e.ActorID, &e.ActorName, &e.Action, &e.TargetID, &e.TargetName, &before, &after, &e.IP); err != nil {
+			log.Printf("GET /api/admin/audit: %v", err)
+			http.Error(w, "Failed to query audit log", http.StatusInternalServerError)
+			return
+		}
+		if before.Valid {
+			e.Before = json.RawMessage(before.String)
+		}
+		if after.Valid {
+			e.After = json.RawMessage(after.String)
+		}
+		entries = append(entries, e)
+	}
+
+	var nextOffset *int
+	if offset+limit < total {
+		next := offset + limit
+		nextOffset = &next
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"entries":     entries,
+		"total":       total,
+		"offset":      offset,
+		"next_offset": nextOffset,
+	})
+}
+
+// handleVoidResult deletes a player's result for a day, for a game that
+// shouldn't count (usually one flagged for cheating). The day can't be
+// recorded again, and the player's stats and the leaderboards are rebuilt.
+func handleVoidResult(w http.ResponseWriter, r *http.Request) {
+	admin := getUserFromRequest(r)
+
+	var body struct {
+		UserID int64  `json:"user_id"`
+		Date   string `json:"date"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if _, err := time.Parse(dateLayout, body.Date); err != nil {
+		http.Error(w, "Invalid date", http.StatusBadRequest)
+		return
+	}
+
+	result, err := store.VoidResult(body.UserID, body.Date)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Result not found", http.StatusNotFound)
+		return
+	}
+	if err == nil {
+		err = refreshUserStats(db, body.UserID)
+	}
+	if err != nil {
+		log.Printf("POST /api/admin/void-result: user %d %s: %v", body.UserID, body.Date, err)
+		http.Error(w, "Failed to void result", http.StatusInternalServerError)
+		return
+	}
+	invalidateLeaderboard()
+	audit(r, admin.ID, "result.void", body.UserID, result, nil)
+	log.Printf("Admin %d voided user %d's result for %s", admin.ID, body.UserID, body.Date)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"ok":true}`))
+}
+
+// handleResetName clears a player's custom name, putting them back on their
+// provider name. They're asked to choose a new one next time they play.
+func handleResetName(w http.ResponseWriter, r *http.Request) {
+	admin := getUserFromRequest(r)
+
+	var body struct {
+		UserID int64 `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	target, err := store.GetUser(body.UserID)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	if err := store.ClearCustomName(body.UserID); err != nil {
+		log.Printf("POST /api/admin/reset-name: user %d: %v", body.UserID, err)
+		http.Error(w, "Failed to reset name", http.StatusInternalServerError)
+		return
+	}
+	invalidateLeaderboard()
+	audit(r, admin.ID, "name.reset", body.UserID,
+		map[string]interface{}{"custom_name": target.CustomName},
+		map[string]interface{}{"custom_name": nil})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"ok":true}`))
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// TestListAuditActionPrefix checks that an action prefix is matched
+// literally, not as a LIKE pattern.
+func TestListAuditActionPrefix(t *testing.T) {
+	useTestDB(t)
+	for _, action := range []string{"sessions.revoke_all", "sessions.revoke", "name_x.set", "namex.set"} {
+		audit(nil, 0, action, 0, nil, nil)
+	}
+
+	tests := []struct {
+		action string
+		want   []string // newest first
+	}{
+		{"sessions.", []string{"sessions.revoke", "sessions.revoke_all"}},
+		{"sessions.revoke_all", []string{"sessions.revoke_all"}},
+		{"name_x.", []string{"name_x.set"}},
+		{"n%.", nil},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		handleListAudit(w, httptest.NewRequest("GET", "/api/admin/audit?action="+url.QueryEscape(tt.action), nil))
+		var resp struct {
+			Entries []AuditEntry `json:"entries"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("action=%s: %v", tt.action, err)
+		}
+		var got []string
+		for _, e := range resp.Entries {
+			got = append(got, e.Action)
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("action=%s: got %v, want %v", tt.action, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("action=%s: got %v, want %v", tt.action, got, tt.want)
+				break
+			}
+		}
+	}
+}
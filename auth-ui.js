@@ -9,6 +9,13 @@ let currentUser = null;
     } catch (e) {
         currentUser = null;
     }
+    try {
+        const resp = await fetch('/auth/providers');
+        const data = await resp.json();
+        authProviders = data.providers.map(p => ({ id: p.id, name: p.name, path: '/auth/' + p.id }));
+    } catch (e) {
+        // keep the built-in list
+    }
     renderAuthUI();
     loadTopPlayers();
     if (currentUser && currentUser.banned) {
@@ -21,6 +28,13 @@ let currentUser = null;
     }
 })();
 
+// Replaced by the server's list (which includes any OIDC providers) on load
+let authProviders = [
+    { id: 'github', name: 'GitHub', path: '/auth/github' },
+    { id: 'discord', name: 'Discord', path: '/auth/discord' },
+    { id: 'google', name: 'Google', path: '/auth/google' }
+];
+
 function renderAuthUI() {
     const area = document.getElementById('authArea');
     if (!area) return;
@@ -57,12 +71,33 @@ function renderAuthUI() {
         strong.textContent = currentUser.display_name;
         info.appendChild(strong);
 
+        const linked = document.createElement('div');
+        linked.id = 'linkedAccounts';
+        linked.style.cssText = 'border-bottom: 1px solid var(--border-color); margin-bottom: 0.25rem;';
+        loadIdentities(linked);
+
+        const exportBtn = document.createElement('button');
+        exportBtn.textContent = 'Download my data';
+        exportBtn.addEventListener('click', () => { window.location.href = '/api/me/export'; });
+
+        const deleteBtn = document.createElement('button');
+        deleteBtn.textContent = 'Delete account';
+        deleteBtn.addEventListener('click', deleteAccount);
+
         const logoutBtn = document.createElement('button');
         logoutBtn.textContent = 'Sign out';
         logoutBtn.addEventListener('click', signOut);
 
+        const logoutAllBtn = document.createElement('button');
+        logoutAllBtn.textContent = 'Sign out everywhere';
+        logoutAllBtn.addEventListener('click', signOutEverywhere);
+
         menu.appendChild(info);
+        menu.appendChild(linked);
+        menu.appendChild(exportBtn);
+        menu.appendChild(deleteBtn);
         menu.appendChild(logoutBtn);
+        menu.appendChild(logoutAllBtn);
         dropdown.appendChild(btn);
         dropdown.appendChild(menu);
         area.appendChild(dropdown);
@@ -80,13 +115,7 @@ function renderAuthUI() {
         menu.className = 'auth-dropdown-menu';
         menu.id = 'authMenu';
 
-        const providers = [
-            { name: 'GitHub', path: '/auth/github', icon: 'github' },
-            { name: 'Discord', path: '/auth/discord', icon: 'discord' },
-            { name: 'Google', path: '/auth/google', icon: 'google' }
-        ];
-
-        providers.forEach(p => {
+        authProviders.forEach(p => {
             const provBtn = document.createElement('button');
             const icon = document.createElement('span');
             icon.className = 'provider-icon';
@@ -94,7 +123,7 @@ function renderAuthUI() {
             provBtn.appendChild(icon);
             const text = document.createTextNode(' ' + p.name);
             provBtn.appendChild(text);
-            provBtn.addEventListener('click', () => { window.location.href = p.path; });
+            provBtn.addEventListener('click', () => { window.location.href = p.path + '?return=' + encodeURIComponent(currentPath()); });
             menu.appendChild(provBtn);
         });
 
@@ -104,6 +133,11 @@ function renderAuthUI() {
     }
 }
 
+// Where to come back to after signing in
+function currentPath() {
+    return window.location.pathname + window.location.search;
+}
+
 function toggleAuthMenu() {
     const menu = document.getElementById('authMenu');
     if (menu) menu.classList.toggle('show');
@@ -120,8 +154,76 @@ document.addEventListener('click', (e) => {
     }
 });
 
+// Fill the account menu with link/unlink buttons for each provider
+async function loadIdentities(container) {
+    let identities = [];
+    try {
+        const resp = await fetch('/api/me/identities');
+        if (!resp.ok) return;
+        identities = (await resp.json()).identities;
+    } catch (e) {
+        return;
+    }
+    const linked = new Set(identities.map(i => i.provider));
+
+    authProviders.forEach(p => {
+        const b = document.createElement('button');
+        if (linked.has(p.id)) {
+            if (linked.size < 2) return;
+            b.textContent = 'Unlink ' + p.name;
+            b.addEventListener('click', () => unlinkIdentity(p));
+        } else {
+            b.textContent = 'Link ' + p.name;
+            b.addEventListener('click', () => { window.location.href = p.path + '?link=1&return=' + encodeURIComponent(currentPath()); });
+        }
+        container.appendChild(b);
+    });
+}
+
+async function unlinkIdentity(p) {
+    if (!confirm('Stop signing in with ' + p.name + '?')) return;
+    const resp = await fetch('/api/me/identities/unlink', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ provider: p.id })
+    });
+    if (!resp.ok) {
+        alert(await resp.text());
+        return;
+    }
+    renderAuthUI();
+}
+
+async function deleteAccount() {
+    if (!confirm('Permanently delete your account, stats and leaderboard history? This cannot be undone.')) return;
+    const resp = await fetch('/api/me', { method: 'DELETE' });
+    if (!resp.ok) {
+        alert('Failed to delete account. Please try again.');
+        return;
+    }
+    currentUser = null;
+    localStorage.removeItem('gameState');
+    localStorage.removeItem('stats');
+    localStorage.removeItem('hardMode');
+    window.location.reload();
+}
+
+async function signOutEverywhere() {
+    if (!confirm('Sign out on all of your devices, including this one?')) return;
+    await fetch('/api/me/sessions', { method: 'DELETE' });
+    currentUser = null;
+    localStorage.removeItem('gameState');
+    localStorage.removeItem('stats');
+    localStorage.removeItem('hardMode');
+    window.location.reload();
+}
+
 async function signOut() {
-    await fetch('/auth/logout', { method: 'POST' });
+    const resp = await fetch('/auth/logout', { method: 'POST' });
+    if (!resp.ok) {
+        showMessage('Sign out failed, please try again');
+        return;
+    }
     currentUser = null;
     // Clear game state so next account doesn't see stale data
     localStorage.removeItem('gameState');
@@ -394,26 +496,11 @@ function updateSettingsForAuth() {
     }
 }
 
-// Submit result to API after game ends
-async function submitResultToAPI(won, guesses, hardModeActive) {
+// onResultRecorded runs once the final guess has been saved, by which point
+// the server has recorded the result from the saved game.
+async function onResultRecorded() {
     if (!currentUser) return;
-    try {
-        const resp = await fetch('/api/result', {
-            method: 'POST',
-            headers: { 'Content-Type': 'application/json' },
-            body: JSON.stringify({
-                date: getDateString(),
-                won: won,
-                guesses: won ? guesses : null,
-                hard_mode: hardModeActive,
-                client_time: new Date().toISOString(),
-                tz_offset: new Date().getTimezoneOffset()
-            })
-        });
-        const data = await resp.json();
-        if (data.tz_warning && typeof showTzWarning === 'function') showTzWarning();
-        loadTopPlayers();
-    } catch (e) {
-        // Silent fail
-    }
+    // Streaks and totals are computed by the server from recorded results
+    if (typeof syncStatsFromServer === 'function') await syncStatsFromServer();
+    loadTopPlayers();
 }
@@ -1,34 +1,20 @@
 package main
 
 import (
-	"crypto/rand"
-	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
-	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var jwtSecret []byte
-
-func init() {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		// Generate a random secret if not set (sessions won't survive restarts)
-		b := make([]byte, 32)
-		rand.Read(b)
-		secret = hex.EncodeToString(b)
-	}
-	jwtSecret = []byte(secret)
-}
-
 type oauthConfig struct {
 	AuthURL     string
 	TokenURL    string
@@ -36,6 +22,8 @@ type oauthConfig struct {
 	ClientID    string
 	ClientSecret string
 	Scopes      string
+	PKCE        bool          // provider accepts an S256 code_challenge
+	OIDC        *oidcProvider // nil for the built-in providers
 }
 
 func getOAuthConfig(provider string) (*oauthConfig, error) {
@@ -48,6 +36,7 @@ func getOAuthConfig(provider string) (*oauthConfig, error) {
 			ClientID:     os.Getenv("GITHUB_CLIENT_ID"),
 			ClientSecret: os.Getenv("GITHUB_CLIENT_SECRET"),
 			Scopes:       "read:user",
+			PKCE:         true,
 		}, nil
 	case "discord":
 		return &oauthConfig{
@@ -66,8 +55,12 @@ func getOAuthConfig(provider string) (*oauthConfig, error) {
 			ClientID:     os.Getenv("GOOGLE_CLIENT_ID"),
 			ClientSecret: os.Getenv("GOOGLE_CLIENT_SECRET"),
 			Scopes:       "https://www.googleapis.com/auth/userinfo.profile",
+			PKCE:         true,
 		}, nil
 	default:
+		if p, ok := oidcProviders[provider]; ok {
+			return p.config()
+		}
 		return nil, fmt.Errorf("unknown provider: %s", provider)
 	}
 }
@@ -75,6 +68,11 @@ func getOAuthConfig(provider string) (*oauthConfig, error) {
 func handleAuthStart(w http.ResponseWriter, r *http.Request) {
 	provider := r.PathValue("provider")
 	cfg, err := getOAuthConfig(provider)
+	if errors.Is(err, errOIDCUnavailable) {
+		log.Printf("OAuth start: %v", err)
+		http.Error(w, provider+" sign-in is unavailable", http.StatusBadGateway)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
@@ -85,28 +83,58 @@ func handleAuthStart(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Generate state token for CSRF protection
-	stateBytes := make([]byte, 16)
-	rand.Read(stateBytes)
-	state := hex.EncodeToString(stateBytes)
+	// ?link=1 adds the provider to the signed-in account instead of signing in
+	if r.URL.Query().Get("link") != "" {
+		user := getUserFromRequest(r)
+		if user == nil {
+			http.Error(w, "Not authenticated", http.StatusUnauthorized)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     "oauth_link",
+			Value:    strconv.FormatInt(user.ID, 10),
+			Path:     "/",
+			MaxAge:   300,
+			HttpOnly: true,
+			Secure:   cookieSecure,
+			SameSite: http.SameSiteLaxMode,
+		})
+	} else {
+		// Drop any abandoned link attempt so this is a plain sign-in
+		http.SetCookie(w, &http.Cookie{
+			Name:   "oauth_link",
+			Path:   "/",
+			MaxAge: -1,
+		})
+	}
+
+	// The state token protects against CSRF and carries the return path;
+	// PKCE and the OIDC nonce bind the code and ID token to this browser
+	flow := oauthFlow{State: newOAuthState(safeReturnPath(r.URL.Query().Get("return")))}
+	if cfg.PKCE {
+		flow.Verifier = randomToken(32)
+	}
+	if cfg.OIDC != nil {
+		flow.Nonce = randomToken(16)
+	}
 
 	http.SetCookie(w, &http.Cookie{
 		Name:     "oauth_state",
-		Value:    state,
+		Value:    flow.encode(),
 		Path:     "/",
 		MaxAge:   300,
 		HttpOnly: true,
-		Secure:   true,
+		Secure:   cookieSecure,
 		SameSite: http.SameSiteLaxMode,
 	})
 
-	callbackURL := fmt.Sprintf("https://wordle-six.tomtom.fyi/auth/%s/callback", provider)
+	callbackURL := oauthCallbackURL(provider)
 
 	params := url.Values{
 		"client_id":    {cfg.ClientID},
 		"redirect_uri": {callbackURL},
 		"scope":        {cfg.Scopes},
-		"state":        {state},
+		"state":        {flow.State},
 	}
 
 	if provider == "google" {
@@ -114,6 +142,13 @@ func handleAuthStart(w http.ResponseWriter, r *http.Request) {
 	} else {
 		params.Set("response_type", "code")
 	}
+	if flow.Verifier != "" {
+		params.Set("code_challenge", pkceChallenge(flow.Verifier))
+		params.Set("code_challenge_method", "S256")
+	}
+	if flow.Nonce != "" {
+		params.Set("nonce", flow.Nonce)
+	}
 
 	http.Redirect(w, r, cfg.AuthURL+"?"+params.Encode(), http.StatusTemporaryRedirect)
 }
@@ -129,11 +164,13 @@ func handleAuthCallback(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid state parameter", http.StatusBadRequest)
 		return
 	}
-	if stateCookie.Value != r.URL.Query().Get("state") {
-		log.Printf("OAuth callback: state mismatch: cookie=%s url=%s", stateCookie.Value, r.URL.Query().Get("state"))
+	flow, ok := decodeOAuthFlow(stateCookie.Value)
+	if !ok || !statesEqual(flow.State, r.URL.Query().Get("state")) {
+		log.Printf("OAuth callback: state mismatch")
 		http.Error(w, "Invalid state parameter", http.StatusBadRequest)
 		return
 	}
+	returnTo := returnPathFromState(flow.State)
 
 	code := r.URL.Query().Get("code")
 	if code == "" {
@@ -143,12 +180,17 @@ func handleAuthCallback(w http.ResponseWriter, r *http.Request) {
 	}
 
 	cfg, err := getOAuthConfig(provider)
+	if errors.Is(err, errOIDCUnavailable) {
+		log.Printf("OAuth callback: %v", err)
+		http.Error(w, provider+" sign-in is unavailable", http.StatusBadGateway)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	callbackURL := fmt.Sprintf("https://wordle-six.tomtom.fyi/auth/%s/callback", provider)
+	callbackURL := oauthCallbackURL(provider)
 
 	// Exchange code for token
 	tokenData := url.Values{
@@ -158,6 +200,9 @@ func handleAuthCallback(w http.ResponseWriter, r *http.Request) {
 		"redirect_uri":  {callbackURL},
 		"grant_type":    {"authorization_code"},
 	}
+	if flow.Verifier != "" {
+		tokenData.Set("code_verifier", flow.Verifier)
+	}
 
 	req, _ := http.NewRequest("POST", cfg.TokenURL, strings.NewReader(tokenData.Encode()))
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
@@ -188,16 +233,78 @@ func handleAuthCallback(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Fetch user info
+	var providerID, displayName, avatarURL string
+	if cfg.OIDC != nil {
+		providerID, displayName, avatarURL, err = cfg.OIDC.profile(tokenResp, accessToken, flow.Nonce)
+		if err != nil {
+			log.Printf("OAuth callback: %s: %v", provider, err)
+			http.Error(w, "Failed to verify identity", http.StatusUnauthorized)
+			return
+		}
+	} else {
+		providerID, displayName, avatarURL, err = fetchProfile(provider, cfg, accessToken)
+		if err != nil {
+			log.Printf("OAuth callback: user info fetch error: %v", err)
+			http.Error(w, "Failed to fetch user info", http.StatusInternalServerError)
+			return
+		}
+	}
+	if providerID == "" {
+		log.Printf("OAuth callback: %s returned no user ID", provider)
+		http.Error(w, "Failed to fetch user info", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("OAuth callback: provider=%s user=%s id=%s", provider, displayName, providerID)
+
+	if linkCookie, err := r.Cookie("oauth_link"); err == nil {
+		handleAuthLink(w, r, linkCookie.Value, returnTo, provider, providerID, displayName, avatarURL)
+		return
+	}
+
+	user, err := store.UpsertUser(provider, providerID, displayName, avatarURL)
+	if err != nil {
+		log.Printf("OAuth callback: UpsertUser failed: %v", err)
+		http.Error(w, "Failed to create user", http.StatusInternalServerError)
+		return
+	}
+	if bootstrapAdmins[provider+":"+providerID] && user.Role != roleAdmin {
+		if err := store.SetRole(user.ID, roleAdmin); err != nil {
+			log.Printf("OAuth callback: failed to grant bootstrap admin: %v", err)
+		} else {
+			log.Printf("OAuth callback: user %d is a bootstrap admin", user.ID)
+			// No actor: the grant comes from BOOTSTRAP_ADMINS, not a person
+			audit(r, 0, "role.grant", user.ID, map[string]interface{}{"role": user.Role}, map[string]interface{}{"role": roleAdmin})
+		}
+	}
+
+	if err := startSession(w, r, user.ID); err != nil {
+		log.Printf("OAuth callback: failed to create session: %v", err)
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("OAuth callback: success, set session cookie for user %d (%s)", user.ID, displayName)
+
+	// Clear oauth state cookie
+	http.SetCookie(w, &http.Cookie{
+		Name:   "oauth_state",
+		Path:   "/",
+		MaxAge: -1,
+	})
+
+	http.Redirect(w, r, returnTo, http.StatusTemporaryRedirect)
+}
+
+// fetchProfile reads a built-in provider's user info endpoint.
+func fetchProfile(provider string, cfg *oauthConfig, accessToken string) (providerID, displayName, avatarURL string, err error) {
 	userReq, _ := http.NewRequest("GET", cfg.UserInfoURL, nil)
 	userReq.Header.Set("Authorization", "Bearer "+accessToken)
 	userReq.Header.Set("Accept", "application/json")
 
 	userResp, err := http.DefaultClient.Do(userReq)
 	if err != nil {
-		log.Printf("OAuth callback: user info fetch error: %v", err)
-		http.Error(w, "Failed to fetch user info", http.StatusInternalServerError)
-		return
+		return "", "", "", err
 	}
 	if userResp.StatusCode != http.StatusOK {
 		log.Printf("OAuth callback: user info endpoint returned %d", userResp.StatusCode)
@@ -209,10 +316,11 @@ func handleAuthCallback(w http.ResponseWriter, r *http.Request) {
 	json.Unmarshal(body, &userInfo)
 
 	// Extract user details based on provider
-	var providerID, displayName, avatarURL string
 	switch provider {
 	case "github":
-		providerID = fmt.Sprintf("%.0f", userInfo["id"].(float64))
+		if id, ok := userInfo["id"].(float64); ok {
+			providerID = fmt.Sprintf("%.0f", id)
+		}
 		displayName, _ = userInfo["login"].(string)
 		avatarURL, _ = userInfo["avatar_url"].(string)
 	case "discord":
@@ -227,48 +335,43 @@ func handleAuthCallback(w http.ResponseWriter, r *http.Request) {
 		displayName, _ = userInfo["name"].(string)
 		avatarURL, _ = userInfo["picture"].(string)
 	}
+	return providerID, displayName, avatarURL, nil
+}
 
-	log.Printf("OAuth callback: provider=%s user=%s id=%s", provider, displayName, providerID)
-
-	user, err := upsertUser(provider, providerID, displayName, avatarURL)
-	if err != nil {
-		log.Printf("OAuth callback: upsertUser failed: %v", err)
-		http.Error(w, "Failed to create user", http.StatusInternalServerError)
-		return
-	}
-
-	// Create JWT
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"sub": user.ID,
-		"exp": time.Now().Add(30 * 24 * time.Hour).Unix(),
-	})
-	tokenString, err := token.SignedString(jwtSecret)
-	if err != nil {
-		log.Printf("OAuth callback: JWT signing failed: %v", err)
-		http.Error(w, "Failed to create session", http.StatusInternalServerError)
-		return
-	}
-
-	log.Printf("OAuth callback: success, setting session cookie for user %d (%s)", user.ID, displayName)
-
+// handleAuthLink finishes a ?link=1 flow by adding the identity to the
+// signed-in user, who must be the one that started it.
+func handleAuthLink(w http.ResponseWriter, r *http.Request, linkUserID, returnTo, provider, providerID, displayName, avatarURL string) {
 	http.SetCookie(w, &http.Cookie{
-		Name:     "session",
-		Value:    tokenString,
-		Path:     "/",
-		MaxAge:   30 * 24 * 60 * 60,
-		HttpOnly: true,
-		Secure:   true,
-		SameSite: http.SameSiteLaxMode,
+		Name:   "oauth_link",
+		Path:   "/",
+		MaxAge: -1,
 	})
-
-	// Clear oauth state cookie
 	http.SetCookie(w, &http.Cookie{
 		Name:   "oauth_state",
 		Path:   "/",
 		MaxAge: -1,
 	})
 
-	http.Redirect(w, r, "/", http.StatusTemporaryRedirect)
+	user := getUserFromRequest(r)
+	if user == nil || strconv.FormatInt(user.ID, 10) != linkUserID {
+		http.Error(w, "Sign in again to link an account", http.StatusUnauthorized)
+		return
+	}
+
+	err := store.LinkIdentity(user.ID, provider, providerID, displayName, avatarURL)
+	if err == errIdentityTaken || err == errProviderLinked {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("OAuth callback: LinkIdentity failed: %v", err)
+		http.Error(w, "Failed to link account", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("OAuth callback: linked %s identity %s to user %d", provider, providerID, user.ID)
+	audit(r, user.ID, "identity.link", user.ID, nil, map[string]interface{}{"provider": provider})
+
+	http.Redirect(w, r, returnTo, http.StatusTemporaryRedirect)
 }
 
 func handleAuthMe(w http.ResponseWriter, r *http.Request) {
@@ -286,6 +389,7 @@ func handleAuthMe(w http.ResponseWriter, r *http.Request) {
 		"avatar_url":   user.AvatarURL,
 		"is_new":       user.IsNew,
 		"banned":       user.Banned,
+		"role":         user.Role,
 	}
 	if user.CustomName != nil {
 		resp["display_name"] = *user.CustomName
@@ -296,48 +400,70 @@ func handleAuthMe(w http.ResponseWriter, r *http.Request) {
 }
 
 func handleAuthLogout(w http.ResponseWriter, r *http.Request) {
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session",
-		Path:     "/",
-		MaxAge:   -1,
-		HttpOnly: true,
-		Secure:   true,
-		SameSite: http.SameSiteLaxMode,
-	})
+	if userID, jti, ok := sessionClaims(r); ok {
+		if err := revokeSession(jti, userID); err != nil {
+			log.Printf("POST /auth/logout: user %d: %v", userID, err)
+			http.Error(w, "Failed to sign out", http.StatusInternalServerError)
+			return
+		}
+	}
+	clearSessionCookie(w)
 	w.WriteHeader(http.StatusOK)
 }
 
 func getUserFromRequest(r *http.Request) *User {
-	cookie, err := r.Cookie("session")
+	// Already looked up by requireRole
+	if user, ok := r.Context().Value(userContextKey).(*User); ok {
+		return user
+	}
+
+	userID, jti, ok := sessionClaims(r)
+	if !ok || !checkSession(jti, userID) {
+		return nil
+	}
+
+	user, err := store.GetUser(userID)
 	if err != nil {
 		return nil
 	}
 
+	return user
+}
+
+// sessionClaims verifies the session cookie's JWT and returns its user and
+// session IDs. Tokens from before sessions were recorded have no jti and are
+// rejected.
+func sessionClaims(r *http.Request) (userID int64, jti string, ok bool) {
+	cookie, err := r.Cookie("session")
+	if err != nil {
+		return 0, "", false
+	}
+
 	token, err := jwt.Parse(cookie.Value, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method")
 		}
-		return jwtSecret, nil
+		kid, _ := token.Header["kid"].(string)
+		return verificationKey(kid)
 	})
 	if err != nil || !token.Valid {
 		log.Printf("Session: invalid JWT: %v", err)
-		return nil
+		return 0, "", false
 	}
 
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		return nil
+		return 0, "", false
 	}
 
-	userID, ok := claims["sub"].(float64)
+	sub, ok := claims["sub"].(float64)
 	if !ok {
-		return nil
+		return 0, "", false
 	}
-
-	user, err := getUserByID(int64(userID))
-	if err != nil {
-		return nil
+	jti, _ = claims["jti"].(string)
+	if jti == "" {
+		return 0, "", false
 	}
 
-	return user
+	return int64(sub), jti, true
 }
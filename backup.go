@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// Backups are consistent snapshots taken with SQLite's online backup API, so
+// they can be made while the server is running. They're written to
+// BACKUP_DIR (default /data/backups) every BACKUP_INTERVAL (default 24h, "0"
+// disables) and only the newest BACKUP_KEEP (default 7) are kept.
+const backupPrefix = "wordle-six-"
+
+var backupMu sync.Mutex
+
+var errBackupUnsupported = errors.New("backups are only supported for SQLite; use pg_dump for PostgreSQL")
+
+func backupDir() string {
+	if dir := os.Getenv("BACKUP_DIR"); dir != "" {
+		return dir
+	}
+	return "/data/backups"
+}
+
+func backupKeep() int {
+	if n, err := strconv.Atoi(os.Getenv("BACKUP_KEEP")); err == nil && n > 0 {
+		return n
+	}
+	return 7
+}
+
+// startBackupSchedule takes a backup every BACKUP_INTERVAL in the background.
+func startBackupSchedule() {
+	if store.Name() != "sqlite" {
+		return
+	}
+	interval := 24 * time.Hour
+	if v := os.Getenv("BACKUP_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			log.Printf("backup: invalid BACKUP_INTERVAL %q, scheduled backups disabled", v)
+			return
+		}
+		interval = d
+	}
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		for range time.Tick(interval) {
+			if _, err := backupDatabase(); err != nil {
+				log.Printf("backup: scheduled backup failed: %v", err)
+			}
+		}
+	}()
+}
+
+// backupDatabase writes a snapshot of the live database to the backup
+// directory, prunes old snapshots and returns the new file's path.
+func backupDatabase() (string, error) {
+	path, err := writeBackup()
+	if err != nil {
+		return "", err
+	}
+	pruneBackups(backupDir(), backupKeep())
+	return path, nil
+}
+
+// writeBackup writes a snapshot without pruning, so it can't delete a backup
+// that's about to be restored.
+func writeBackup() (string, error) {
+	if store.Name() != "sqlite" {
+		return "", errBackupUnsupported
+	}
+	backupMu.Lock()
+	defer backupMu.Unlock()
+
+	dir := backupDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, backupPrefix+time.Now().UTC().Format("20060102-150405.000")+".db")
+	// Names are unique to the millisecond and backupMu serializes writers,
+	// but never let a rename replace an earlier backup
+	if _, err := os.Stat(path); err == nil {
+		return "", fmt.Errorf("backup %s already exists", path)
+	}
+	tmp := path + ".tmp"
+	os.Remove(tmp)
+
+	dest, err := sql.Open("sqlite3", tmp)
+	if err != nil {
+		return "", err
+	}
+	err = copySQLite(dest, db)
+	if err == nil {
+		// The copy inherits WAL mode; switch it back so the backup is a
+		// single self-contained file
+		_, err = dest.Exec("PRAGMA journal_mode=DELETE")
+	}
+	dest.Close()
+	if err == nil {
+		// Only a finished backup gets a name that restore and pruning see
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+
+	log.Printf("backup: wrote %s", path)
+	return path, nil
+}
+
+// copySQLite replaces the contents of dest with src using the backup API.
+func copySQLite(dest, src *sql.DB) error {
+	ctx := context.Background()
+	destConn, err := dest.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	return destConn.Raw(func(d interface{}) error {
+		return srcConn.Raw(func(s interface{}) error {
+			bk, err := d.(*sqlite3.SQLiteConn).Backup("main", s.(*sqlite3.SQLiteConn), "main")
+			if err != nil {
+				return err
+			}
+			// Step returns false without an error while the source is locked
+			for tries := 0; ; tries++ {
+				done, err := bk.Step(-1)
+				if err != nil {
+					bk.Finish()
+					return err
+				}
+				if done {
+					break
+				}
+				if tries == 50 {
+					bk.Finish()
+					return errors.New("database stayed locked")
+				}
+				time.Sleep(100 * time.Millisecond)
+			}
+			return bk.Finish()
+		})
+	})
+}
+
+// listBackups returns backup file names in the directory, oldest first. The
+// timestamp in the name makes lexical order chronological.
+func listBackups(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasPrefix(e.Name(), backupPrefix) && strings.HasSuffix(e.Name(), ".db") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func pruneBackups(dir string, keep int) {
+	names, err := listBackups(dir)
+	if err != nil {
+		log.Printf("backup: prune: %v", err)
+		return
+	}
+	for len(names) > keep {
+		if err := os.Remove(filepath.Join(dir, names[0])); err != nil {
+			log.Printf("backup: prune: %v", err)
+		} else {
+			log.Printf("backup: removed %s", names[0])
+		}
+		names = names[1:]
+	}
+}
+
+// validateBackup checks a backup file is an intact database with a schema
+// this build can run: not newer than its latest migration.
+func validateBackup(path string) (int, error) {
+	if _, err := os.Stat(path); err != nil {
+		return 0, err
+	}
+	bdb, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return 0, err
+	}
+	defer bdb.Close()
+
+	var integrity string
+	if err := bdb.QueryRow("PRAGMA integrity_check").Scan(&integrity); err != nil {
+		return 0, fmt.Errorf("not a readable SQLite database: %w", err)
+	}
+	if integrity != "ok" {
+		return 0, fmt.Errorf("integrity check failed: %s", integrity)
+	}
+
+	version, err := schemaVersion(bdb)
+	if err != nil {
+		return 0, fmt.Errorf("no schema_migrations table: %w", err)
+	}
+	if version == 0 {
+		return 0, errors.New("no migrations recorded")
+	}
+	if version > latestSchemaVersion() {
+		return 0, fmt.Errorf("schema version %d is newer than this build supports (%d)", version, latestSchemaVersion())
+	}
+	return version, nil
+}
+
+// restoreDatabase validates a backup, snapshots the current database and
+// then copies the backup over it. The snapshot isn't followed by pruning,
+// which could otherwise remove the oldest backup, the one being restored.
+// The server must not be running. Pending migrations are applied on the
+// next start.
+func restoreDatabase(path string) error {
+	version, err := validateBackup(path)
+	if err != nil {
+		return fmt.Errorf("invalid backup %s: %w", path, err)
+	}
+	if err := openDB(); err != nil {
+		return err
+	}
+	if store.Name() != "sqlite" {
+		return errBackupUnsupported
+	}
+
+	current, err := writeBackup()
+	if err != nil {
+		return fmt.Errorf("could not back up current database first: %w", err)
+	}
+
+	src, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	if err := copySQLite(db, src); err != nil {
+		return err
+	}
+	log.Printf("backup: restored %s (schema version %d); previous database saved to %s", path, version, current)
+	return nil
+}
+
+// handleAdminBackup takes a backup on demand.
+func handleAdminBackup(w http.ResponseWriter, r *http.Request) {
+	path, err := backupDatabase()
+	if err == errBackupUnsupported {
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+		return
+	}
+	if err != nil {
+		log.Printf("POST /api/admin/backup: %v", err)
+		http.Error(w, "Backup failed", http.StatusInternalServerError)
+		return
+	}
+	names, _ := listBackups(backupDir())
+	audit(r, getUserFromRequest(r).ID, "backup.create", 0, nil, map[string]interface{}{"file": filepath.Base(path)})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ok":      true,
+		"file":    filepath.Base(path),
+		"backups": names,
+	})
+}
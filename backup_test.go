@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestRestoreOldestBackup restores the oldest backup while the retention
+// window is full, which used to prune that backup away before it was read.
+func TestRestoreOldestBackup(t *testing.T) {
+	dir := t.TempDir()
+	backups := filepath.Join(dir, "backups")
+	t.Setenv("DATABASE_URL", "")
+	t.Setenv("DB_PATH", filepath.Join(dir, "live.db"))
+	t.Setenv("BACKUP_DIR", backups)
+	t.Setenv("BACKUP_KEEP", "3")
+
+	if err := initDB(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO users (id, provider, provider_id, display_name) VALUES (1, 'github', '1', 'Original')"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Fill the window, oldest first, renaming each to its own timestamp.
+	var oldest string
+	for i, stamp := range []string{"20240101-000000.000", "20240102-000000.000", "20240103-000000.000"} {
+		path, err := backupDatabase()
+		if err != nil {
+			t.Fatal(err)
+		}
+		named := filepath.Join(backups, backupPrefix+stamp+".db")
+		if err := os.Rename(path, named); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			oldest = named
+		}
+		if _, err := db.Exec("UPDATE users SET display_name = ? WHERE id = 1", "Changed "+stamp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	if err := restoreDatabase(oldest); err != nil {
+		t.Fatalf("restoring the oldest backup: %v", err)
+	}
+	defer db.Close()
+
+	if _, err := os.Stat(oldest); err != nil {
+		t.Errorf("restored backup is gone: %v", err)
+	}
+	var name string
+	if err := db.QueryRow("SELECT display_name FROM users WHERE id = 1").Scan(&name); err != nil {
+		t.Fatal(err)
+	}
+	if name != "Original" {
+		t.Errorf("display_name after restore = %q, want %q", name, "Original")
+	}
+	names, err := listBackups(backups)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 4 {
+		t.Errorf("got backups %v, want the 3 kept plus the pre-restore snapshot", names)
+	}
+}
+
+// TestBackupsInTheSameSecond takes two backups back to back; the second used
+// to replace the first.
+func TestBackupsInTheSameSecond(t *testing.T) {
+	useTestDB(t)
+	backups := filepath.Join(t.TempDir(), "backups")
+	t.Setenv("BACKUP_DIR", backups)
+
+	first, err := writeBackup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * time.Millisecond)
+	second, err := writeBackup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first == second {
+		t.Fatalf("both backups written to %s", first)
+	}
+	names, err := listBackups(backups)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 {
+		t.Errorf("got backups %v, want 2", names)
+	}
+}
@@ -28,10 +28,14 @@ func checkTimezone(userID int64, clientTime string, tzOffset int, ip string, end
 	now := time.Now().UTC()
 
 	// Insert event
-	_, err := db.Exec(`
-		INSERT INTO tz_events (user_id, server_utc, client_time, tz_offset, ip, endpoint)
-		VALUES (?, ?, ?, ?, ?, ?)
-	`, userID, now.Format(time.RFC3339), clientTime, tzOffset, ip, endpoint)
+	err := store.InsertTzEvent(&TzEvent{
+		UserID:     userID,
+		ServerUTC:  now,
+		ClientTime: clientTime,
+		TzOffset:   tzOffset,
+		IP:         ip,
+		Endpoint:   endpoint,
+	})
 	if err != nil {
 		log.Printf("cheatdetect: failed to insert tz_event: %v", err)
 	}
@@ -48,18 +52,10 @@ func checkTimezone(userID int64, clientTime string, tzOffset int, ip string, end
 	}
 
 	// 2. Timezone drift detection: check if offset changed within 30 min
-	var prevOffset int
-	var prevServerUTC string
-	err = db.QueryRow(`
-		SELECT tz_offset, server_utc FROM tz_events
-		WHERE user_id = ? AND id != (SELECT MAX(id) FROM tz_events WHERE user_id = ?)
-		ORDER BY server_utc DESC LIMIT 1
-	`, userID, userID).Scan(&prevOffset, &prevServerUTC)
-	if err == nil {
-		prevTime, parseErr := time.Parse(time.RFC3339, prevServerUTC)
-		if parseErr == nil && now.Sub(prevTime) < 30*time.Minute {
-			if prevOffset != tzOffset {
-				reasons = append(reasons, fmt.Sprintf("tz_drift=%d->%d_in_%s", prevOffset, tzOffset, now.Sub(prevTime).Round(time.Second)))
+	if prev, err := store.PreviousTzEvent(userID); err == nil {
+		if now.Sub(prev.ServerUTC) < 30*time.Minute {
+			if prev.TzOffset != tzOffset {
+				reasons = append(reasons, fmt.Sprintf("tz_drift=%d->%d_in_%s", prev.TzOffset, tzOffset, now.Sub(prev.ServerUTC).Round(time.Second)))
 			}
 		}
 	}
@@ -74,32 +70,57 @@ func checkTimezone(userID int64, clientTime string, tzOffset int, ip string, end
 				expectedOffsetMin := -(expectedOffset / 60) // JS getTimezoneOffset is inverted
 				diff := math.Abs(float64(tzOffset - expectedOffsetMin))
 				if diff > 120 { // more than 2 hours off
-					reasons = append(reasons, fmt.Sprintf("ip_tz_mismatch: ip=%s geo_tz=%s expected_offset=%d got=%d", ip, geoTZ, expectedOffsetMin, tzOffset))
+					reasons = append(reasons, fmt.Sprintf("ip_tz_mismatch: geo_tz=%s expected_offset=%d got=%d", geoTZ, expectedOffsetMin, tzOffset))
 				}
 			}
 		}
 	}
 
 	if len(reasons) > 0 {
-		// Look up display name for logging
-		var displayName string
-		db.QueryRow("SELECT COALESCE(custom_name, display_name) FROM users WHERE id = ?", userID).Scan(&displayName)
-
-		logEntry := fmt.Sprintf("[%s] user_id=%d name=%q reasons=[%s] client_time=%s tz_offset=%d ip=%s endpoint=%s\n",
-			now.Format(time.RFC3339), userID, displayName, strings.Join(reasons, "; "), clientTime, tzOffset, ip, endpoint)
+		logEntry := fmt.Sprintf("[%s] user_id=%d reasons=[%s] client_time=%s tz_offset=%d endpoint=%s\n",
+			now.Format(time.RFC3339), userID, strings.Join(reasons, "; "), clientTime, tzOffset, endpoint)
+		insertCheatFlag(userID, "", endpoint, strings.Join(reasons, "; "))
+		writeCheatLog(logEntry)
+		return true
+	}
 
-		log.Printf("cheatdetect: %s", logEntry)
+	return false
+}
 
-		f, err := os.OpenFile("/data/cheatlog.txt", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		if err == nil {
-			f.WriteString(logEntry)
-			f.Close()
-		}
+// flagGame records a game whose client-reported state disagreed with the
+// server's replay of it.
+func flagGame(userID int64, date, endpoint, reason string) {
+	logEntry := fmt.Sprintf("[%s] user_id=%d reasons=[%s] date=%s endpoint=%s\n",
+		time.Now().UTC().Format(time.RFC3339), userID, reason, date, endpoint)
+	insertCheatFlag(userID, date, endpoint, reason)
+	writeCheatLog(logEntry)
+}
 
-		return true
+func insertCheatFlag(userID int64, date, endpoint, reason string) {
+	var datePtr *string
+	if date != "" {
+		datePtr = &date
+	}
+	_, err := db.Exec(
+		"INSERT INTO cheat_flags (user_id, date, endpoint, reason) VALUES (?, ?, ?, ?)",
+		userID, datePtr, endpoint, reason,
+	)
+	if err != nil {
+		log.Printf("cheatdetect: failed to insert cheat_flag: %v", err)
 	}
+}
 
-	return false
+// writeCheatLog appends to the flat log, which outlives account deletion, so
+// entries carry only the user ID: names and IPs stay in the database, where
+// deleting the account removes them.
+func writeCheatLog(logEntry string) {
+	log.Printf("cheatdetect: %s", logEntry)
+
+	f, err := os.OpenFile("/data/cheatlog.txt", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err == nil {
+		f.WriteString(logEntry)
+		f.Close()
+	}
 }
 
 // getGeoTimezone returns the IANA timezone for an IP, using a 24h cache.
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// defaultPublicURL is the production site, also written into index.html.
+const defaultPublicURL = "https://wordle-six.tomtom.fyi"
+
+// publicURL is where players reach the site (PUBLIC_URL, no trailing slash).
+// It builds the OAuth redirect URIs, which must be registered with each
+// provider, and the absolute URLs in index.html.
+var publicURL = defaultPublicURL
+
+// cookieSecure marks cookies Secure. COOKIE_SECURE overrides the default,
+// which is on for an https PUBLIC_URL, e.g. to test over plain http.
+var cookieSecure = true
+
+func init() {
+	if v := os.Getenv("PUBLIC_URL"); v != "" {
+		u, err := url.Parse(v)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.Trim(u.Path, "/") != "" {
+			log.Fatalf("PUBLIC_URL %q must be an http(s) URL with no path", v)
+		}
+		publicURL = strings.TrimSuffix(v, "/")
+	}
+	cookieSecure = strings.HasPrefix(publicURL, "https://")
+	if v := os.Getenv("COOKIE_SECURE"); v != "" {
+		secure, err := strconv.ParseBool(v)
+		if err != nil {
+			log.Fatalf("COOKIE_SECURE %q must be true or false", v)
+		}
+		cookieSecure = secure
+	}
+}
+
+func oauthCallbackURL(provider string) string {
+	return publicURL + "/auth/" + provider + "/callback"
+}
+
+// serveIndex serves index.html with its share and preview URLs pointing at
+// this instance.
+func serveIndex(w http.ResponseWriter, r *http.Request, staticDir string) {
+	page, err := os.ReadFile(filepath.Join(staticDir, "index.html"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if publicURL != defaultPublicURL {
+		page = []byte(strings.ReplaceAll(string(page), defaultPublicURL, publicURL))
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(page)
+}
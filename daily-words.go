@@ -0,0 +1,101 @@
+package main
+
+// dailyWords is the ordered list of daily answers. It lives in Go rather than
+// in the static files so the browser never sees it; the day's word is only
+// revealed by the API once that player's game is over. dailyWordIndex picks
+// from it, so words must only ever be appended.
+var dailyWords = []string{
+	"ABROAD", "ACCEPT", "ACTUAL", "ADVENT", "ADVICE", "AFFIRM", "AFRAID", "AGREED",
+	"ANCHOR", "ANIMAL", "ANNUAL", "ANSWER", "ANYONE", "ANYWAY", "APPEAL", "APPEAR",
+	"AROUND", "ARRIVE", "ARTIST", "ASPECT", "ASSURE", "ATTACH", "ATTACK", "ATTEND",
+	"AUTHOR", "AUTUMN", "AVENUE", "AWAKEN", "BACKUP", "BALLOT", "BANANA", "BANNER",
+	"BARREL", "BASKET", "BATTLE", "BEACON", "BEAUTY", "BECAME", "BEFORE", "BEHALF",
+	"BEHAVE", "BEHIND", "BELIEF", "BELONG", "BETTER", "BEYOND", "BINARY", "BISHOP",
+	"BITTER", "BORROW", "BOTTLE", "BOTTOM", "BOUGHT", "BRANCH", "BREACH", "BREATH",
+	"BRIDGE", "BRIGHT", "BROKEN", "BRONZE", "BRUTAL", "BUCKET", "BUDGET", "BURDEN",
+	"BUREAU", "BUTTON", "CAMERA", "CAMPUS", "CANCEL", "CANCER", "CANVAS", "CARBON",
+	"CAREER", "CARPET", "CASTLE", "CASUAL", "CAUGHT", "CENTER", "CEREAL", "CHANCE",
+	"CHANGE", "CHAPEL", "CHARGE", "CHOICE", "CHOOSE", "CHOSEN", "CHROME", "CHURCH",
+	"CINEMA", "CIRCLE", "CIRCUS", "CLAIMS", "CLIENT", "CLOSED", "CLOSER", "CLOSET",
+	"CLOTHE", "CLOUDY", "COARSE", "COFFEE", "COLUMN", "COMBAT", "COMING", "COMMON",
+	"COMPEL", "COMPLY", "CONCUR", "CORNER", "COSMIC", "COTTON", "COUNTY", "COUPLE",
+	"COUPON", "COURSE", "COUSIN", "CRAFTY", "CREATE", "CREDIT", "CRISIS", "CRITIC",
+	"CRUISE", "CUSTOM", "DAMAGE", "DANCER", "DANGER", "DEBATE", "DECADE", "DECENT",
+	"DECIDE", "DEFEAT", "DEFEND", "DEFINE", "DEGREE", "DEMAND", "DENTAL", "DEPLOY",
+	"DEPUTY", "DESERT", "DESIGN", "DESIRE", "DETAIL", "DETECT", "DEVICE", "DEVOTE",
+	"DIALOG", "DIFFER", "DIGEST", "DINNER", "DIRECT", "DIVIDE", "DIVINE", "DOCTOR",
+	"DOMAIN", "DONATE", "DOUBLE", "DRAWER", "DRIVEN", "DRIVER", "DURING", "EARNED",
+	"EASILY", "EATING", "EDITOR", "EFFECT", "EFFORT", "EIGHTH", "EITHER", "ELEVEN",
+	"EMBARK", "EMERGE", "EMPIRE", "EMPLOY", "ENABLE", "ENDING", "ENDURE", "ENERGY",
+	"ENGAGE", "ENGINE", "ENOUGH", "ENRICH", "ENSURE", "ENTIRE", "ENTITY", "EQUITY",
+	"ESCAPE", "ESTATE", "ETHNIC", "EVOLVE", "EXCEED", "EXCEPT", "EXCUSE", "EXEMPT",
+	"EXPAND", "EXPECT", "EXPERT", "EXPORT", "EXPOSE", "EXTEND", "EXTENT", "FABRIC",
+	"FACIAL", "FACTOR", "FAILED", "FAIRLY", "FALLEN", "FAMILY", "FAMOUS", "FATHER",
+	"FAULTS", "FAVOUR", "FEMALE", "FIERCE", "FIGURE", "FILING", "FILTER", "FINALE",
+	"FINGER", "FINISH", "FISCAL", "FLAVOR", "FLIGHT", "FLORAL", "FLOWER", "FLYING",
+	"FOLLOW", "FORBID", "FORCED", "FOREST", "FORGET", "FORMAL", "FORMAT", "FORMER",
+	"FOSTER", "FOUGHT", "FOURTH", "FREEZE", "FRENCH", "FRIEND", "FROZEN", "FUSION",
+	"FUTURE", "GALAXY", "GARAGE", "GARDEN", "GATHER", "GENDER", "GENIUS", "GENTLE",
+	"GLOBAL", "GOLDEN", "GOVERN", "GRAVEL", "GROUND", "GROWTH", "GUILTY", "GUITAR",
+	"HAPPEN", "HARDLY", "HATRED", "HEALTH", "HEARTS", "HEATED", "HEAVEN", "HEIGHT",
+	"HELMET", "HEREBY", "HEREIN", "HEROES", "HIDDEN", "HIGHLY", "HONEST", "HONOUR",
+	"HOPING", "HORROR", "HUMANE", "HUMBLE", "HUNGER", "HUNTER", "IGNORE", "IMPACT",
+	"IMPORT", "IMPOSE", "INCOME", "INDEED", "INDOOR", "INDUCE", "INFANT", "INFORM",
+	"INJURE", "INJURY", "INLINE", "INSECT", "INSERT", "INSIDE", "INSIST", "INTEND",
+	"INTENT", "INVEST", "INVITE", "INVOKE", "INWARD", "ISLAND", "ITSELF", "JACKET",
+	"JOINED", "JUNGLE", "JUNIOR", "KERNEL", "KNIGHT", "LABOUR", "LADDER", "LANDED",
+	"LAPTOP", "LATELY", "LATEST", "LATTER", "LAUNCH", "LAWYER", "LEADER", "LEAGUE",
+	"LEARNT", "LEGACY", "LEGEND", "LENGTH", "LESSON", "LETTER", "LIABLE", "LIKELY",
+	"LINEAR", "LIQUID", "LISTEN", "LITTLE", "LIVING", "LOCATE", "LOCKED", "LONELY",
+	"LONGER", "LOSING", "LOVELY", "LUXURY", "MAINLY", "MAKING", "MANAGE", "MANNER",
+	"MANUAL", "MARBLE", "MARGIN", "MARINE", "MARKED", "MARKET", "MASTER", "MATTER",
+	"MATURE", "MEADOW", "MEDIUM", "MEMBER", "MEMORY", "MENTAL", "MENTOR", "MERELY",
+	"MERGER", "METHOD", "METRIC", "MIDDLE", "MINING", "MINUTE", "MIRROR", "MISERY",
+	"MOBILE", "MODERN", "MODEST", "MODIFY", "MODULE", "MOMENT", "MONDAY", "MONKEY",
+	"MORTAL", "MOSTLY", "MOTHER", "MOTION", "MOTIVE", "MOVING", "MURDER", "MUSEUM",
+	"MUTUAL", "MYSTIC", "NAMELY", "NARROW", "NATION", "NATIVE", "NATURE", "NEARBY",
+	"NEARLY", "NEEDED", "NEEDLE", "NEURAL", "NICELY", "NOBODY", "NORMAL", "NOTICE",
+	"NOTION", "NOUGHT", "NUMBER", "OBJECT", "OBTAIN", "OCCUPY", "OFFEND", "OFFICE",
+	"OFFSET", "ONLINE", "ONWARD", "OPENED", "OPENER", "OPENLY", "OPPOSE", "OPTION",
+	"ORACLE", "ORANGE", "ORIGIN", "OUTPUT", "OUTSET", "OXYGEN", "PACKED", "PACKET",
+	"PALACE", "PARADE", "PARDON", "PARENT", "PARTLY", "PASSED", "PATENT", "PATROL",
+	"PATRON", "PENCIL", "PEOPLE", "PEPPER", "PERIOD", "PERMIT", "PERSON", "PHRASE",
+	"PICKED", "PICNIC", "PIRATE", "PLACED", "PLANET", "PLAYER", "PLEASE", "PLEDGE",
+	"PLENTY", "POCKET", "POETRY", "POLICE", "POLICY", "POLISH", "PORTAL", "POSTER",
+	"POTATO", "POTENT", "POWDER", "PRAISE", "PRAYER", "PREFER", "PRETTY", "PRIEST",
+	"PRINCE", "PRISON", "PROFIT", "PROMPT", "PROPER", "PROVEN", "PUBLIC", "PURELY",
+	"PURPLE", "PURSUE", "PUZZLE", "RABBIT", "RACIAL", "RADIUS", "RAISED", "RANDOM",
+	"RANGER", "RANKED", "RARELY", "RATHER", "RATING", "READER", "REALLY", "REASON",
+	"RECALL", "RECENT", "RECORD", "REDUCE", "REFORM", "REFUGE", "REFUND", "REFUSE",
+	"REGARD", "REGIME", "REGION", "REGRET", "REJECT", "RELATE", "RELIEF", "REMAIN",
+	"REMARK", "REMEDY", "REMIND", "REMOTE", "REMOVE", "RENDER", "RENTAL", "REPAIR",
+	"REPEAT", "REPLAY", "REPORT", "RESCUE", "RESIDE", "RESIGN", "RESIST", "RESORT",
+	"RESULT", "RESUME", "RETAIL", "RETAIN", "RETIRE", "RETURN", "REVEAL", "REVIEW",
+	"REVISE", "REWARD", "RIBBON", "RICHES", "RIDDLE", "RISING", "RITUAL", "ROBUST",
+	"ROCKET", "ROTATE", "ROTTEN", "ROWING", "RUBBER", "RULING", "RUMOUR", "RUSHED",
+	"SACRED", "SAFETY", "SAILOR", "SALARY", "SALMON", "SAMPLE", "SAVING", "SAYING",
+	"SCENIC", "SCHEME", "SCHOOL", "SCREEN", "SCRIPT", "SEARCH", "SEASON", "SECOND",
+	"SECRET", "SECTOR", "SECURE", "SEEING", "SELECT", "SELLER", "SENIOR", "SENSOR",
+	"SERIAL", "SERIES", "SERVED", "SERVER", "SETTLE", "SEVERE", "SHADOW", "SHAPED",
+	"SHARED", "SHIELD", "SHOULD", "SHOWER", "SHRINE", "SIGNAL", "SIGNED", "SILENT",
+	"SILVER", "SIMPLE", "SIMPLY", "SINGLE", "SISTER", "SKETCH", "SLOGAN", "SMOOTH",
+	"SOCIAL", "SOCKET", "SOLELY", "SOLEMN", "SOLVED", "SOURCE", "SPEECH", "SPHERE",
+	"SPIRIT", "SPOKEN", "SPREAD", "SPRING", "SQUARE", "STABLE", "STATED", "STATIC",
+	"STATUE", "STATUS", "STEADY", "STOLEN", "STRAIN", "STRAND", "STREAM", "STREET",
+	"STRESS", "STRICT", "STRIKE", "STRING", "STROKE", "STRONG", "STUDIO", "SUBMIT",
+	"SUBTLE", "SUBURB", "SUDDEN", "SUFFER", "SUMMER", "SUMMIT", "SUNDAY", "SUPPLY",
+	"SURELY", "SURVEY", "SWITCH", "SYMBOL", "SYNTAX", "SYSTEM", "TABLET", "TACKLE",
+	"TACTIC", "TAKING", "TALENT", "TARGET", "TAUGHT", "TEMPLE", "TENANT", "TENDER",
+	"TERROR", "THANKS", "THEORY", "THESIS", "THIRTY", "THOUGH", "THREAD", "THREAT",
+	"THRILL", "THRONE", "THROWN", "THRUST", "TICKET", "TIMBER", "TIMING", "TISSUE",
+	"TOWARD", "TRADER", "TRAGIC", "TRAVEL", "TREATY", "TRENDY", "TRIBAL", "TRIPLE",
+	"TROPHY", "TRUSTY", "TRYING", "TUNNEL", "TURKEY", "TURNED", "TWELVE", "TWENTY",
+	"UNABLE", "UNFAIR", "UNFOLD", "UNIQUE", "UNITED", "UNLIKE", "UNLOCK", "UNSEEN",
+	"UNUSED", "UNVEIL", "UNWRAP", "UPBEAT", "UPDATE", "UPLOAD", "UPWARD", "URGENT",
+	"USEFUL", "VACANT", "VALLEY", "VARIED", "VASTLY", "VECTOR", "VENDOR", "VERBAL",
+	"VERIFY", "VESSEL", "VICTIM", "VIEWER", "VIKING", "VIOLIN", "VIRTUE", "VISION",
+	"VISUAL", "VOLUME", "VOTING", "VOYAGE", "WALKED", "WALLET", "WANDER", "WANTED",
+	"WARMLY", "WEALTH", "WEAPON", "WEEKLY", "WEIGHT", "WHOLLY", "WICKED", "WIDELY",
+	"WIDGET", "WINDOW", "WINNER", "WINTER", "WISDOM", "WIZARD", "WONDER", "WOODEN",
+	"WORKER", "WORTHY", "WRITER", "YELLOW", "YOGURT", "ZOMBIE", "ZONING",
+}
@@ -2,30 +2,30 @@ package main
 
 import (
 	"database/sql"
-	"os"
-	"path/filepath"
-
-	_ "github.com/mattn/go-sqlite3"
 )
 
+// db is the active backend's connection pool, used for the queries that
+// aren't part of Storage.
 var db *sql.DB
 
-func initDB() error {
-	dbPath := os.Getenv("DB_PATH")
-	if dbPath == "" {
-		dbPath = "/data/wordle-six.db"
-	}
+// querier is satisfied by both *sql.DB and *sql.Tx, so helpers can run
+// standalone or inside a migration's transaction.
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
 
-	// Ensure directory exists
-	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+// initDB opens the database and brings its schema up to date.
+func initDB() error {
+	if err := openDB(); err != nil {
 		return err
 	}
-
-	var err error
-	db, err = sql.Open("sqlite3", dbPath+"?_journal_mode=WAL&_busy_timeout=5000")
+	unlock, err := store.lockSchema()
 	if err != nil {
 		return err
 	}
+	defer unlock()
 
 	if err := createTables(); err != nil {
 		return err
@@ -33,8 +33,21 @@ func initDB() error {
 	return runMigrations()
 }
 
+// openDB opens the configured storage backend without touching its schema.
+func openDB() error {
+	var err error
+	store, err = openStorage()
+	if err != nil {
+		return err
+	}
+	db = store.DB()
+	return nil
+}
+
+// createTables holds the baseline schema, written for SQLite and adapted by
+// ddl() for PostgreSQL. Later changes belong in migrations.go.
 func createTables() error {
-	_, err := db.Exec(`
+	_, err := db.Exec(ddl(`
 		CREATE TABLE IF NOT EXISTS users (
 			id INTEGER PRIMARY KEY,
 			provider TEXT NOT NULL,
@@ -57,6 +70,7 @@ func createTables() error {
 			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			UNIQUE(user_id, date)
 		);
+		CREATE INDEX IF NOT EXISTS idx_game_results_date ON game_results(date);
 
 		CREATE TABLE IF NOT EXISTS user_stats (
 			user_id INTEGER PRIMARY KEY REFERENCES users(id),
@@ -91,7 +105,43 @@ func createTables() error {
 			endpoint TEXT NOT NULL
 		);
 		CREATE INDEX IF NOT EXISTS idx_tz_events_user ON tz_events(user_id, server_utc DESC);
-	`)
+
+		CREATE TABLE IF NOT EXISTS cheat_flags (
+			id INTEGER PRIMARY KEY,
+			user_id INTEGER NOT NULL,
+			date TEXT,
+			endpoint TEXT NOT NULL,
+			reason TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE INDEX IF NOT EXISTS idx_cheat_flags_user ON cheat_flags(user_id, created_at DESC);
+
+		CREATE TABLE IF NOT EXISTS player_groups (
+			id INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			invite_code TEXT NOT NULL UNIQUE,
+			created_by INTEGER NOT NULL REFERENCES users(id),
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE TABLE IF NOT EXISTS group_members (
+			group_id INTEGER NOT NULL REFERENCES player_groups(id),
+			user_id INTEGER NOT NULL REFERENCES users(id),
+			is_admin BOOLEAN NOT NULL DEFAULT FALSE,
+			joined_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (group_id, user_id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_group_members_user ON group_members(user_id);
+
+		CREATE TABLE IF NOT EXISTS friendships (
+			requester_id INTEGER NOT NULL REFERENCES users(id),
+			addressee_id INTEGER NOT NULL REFERENCES users(id),
+			accepted BOOLEAN NOT NULL DEFAULT FALSE,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (requester_id, addressee_id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_friendships_addressee ON friendships(addressee_id);
+	`))
 	return err
 }
 
@@ -103,79 +153,37 @@ type User struct {
 	CustomName  *string `json:"custom_name,omitempty"`
 	AvatarURL   string  `json:"avatar_url,omitempty"`
 	Banned      bool    `json:"-"`
+	Role        string  `json:"-"`
 	IsNew       bool    `json:"is_new,omitempty"`
 }
 
-func upsertUser(provider, providerID, displayName, avatarURL string) (*User, error) {
-	result, err := db.Exec(`
-		INSERT INTO users (provider, provider_id, display_name, avatar_url)
-		VALUES (?, ?, ?, ?)
-		ON CONFLICT(provider, provider_id)
-		DO UPDATE SET display_name = excluded.display_name, avatar_url = excluded.avatar_url
-	`, provider, providerID, displayName, avatarURL)
-	if err != nil {
-		return nil, err
-	}
-
-	// Get the user ID (last insert or existing)
-	id, err := result.LastInsertId()
-	if err != nil || id == 0 {
-		row := db.QueryRow("SELECT id FROM users WHERE provider = ? AND provider_id = ?", provider, providerID)
-		if err := row.Scan(&id); err != nil {
-			return nil, err
-		}
-	}
-
-	return &User{
-		ID:          id,
-		Provider:    provider,
-		ProviderID:  providerID,
-		DisplayName: displayName,
-		AvatarURL:   avatarURL,
-	}, nil
-}
-
-func getUserByID(id int64) (*User, error) {
-	u := &User{}
-	var customName *string
-	err := db.QueryRow("SELECT id, provider, provider_id, display_name, custom_name, COALESCE(avatar_url, ''), banned FROM users WHERE id = ?", id).
-		Scan(&u.ID, &u.Provider, &u.ProviderID, &u.DisplayName, &customName, &u.AvatarURL, &u.Banned)
-	if err != nil {
-		return nil, err
-	}
-	u.CustomName = customName
-	u.IsNew = customName == nil
-	return u, nil
-}
-
+// banUser also ends the user's sessions, so they're signed out everywhere.
 func banUser(userID int64) error {
-	_, err := db.Exec("UPDATE users SET banned = TRUE WHERE id = ?", userID)
+	err := store.SetBanned(userID, true)
+	if err == nil {
+		err = revokeUserSessions(userID)
+	}
+	invalidateLeaderboard()
 	return err
 }
 
 func unbanUser(userID int64) error {
-	_, err := db.Exec("UPDATE users SET banned = FALSE WHERE id = ?", userID)
+	err := store.SetBanned(userID, false)
+	invalidateLeaderboard()
 	return err
 }
 
-func runMigrations() error {
-	db.Exec("ALTER TABLE users ADD COLUMN custom_name TEXT")
-	db.Exec("ALTER TABLE users ADD COLUMN banned BOOLEAN NOT NULL DEFAULT FALSE")
-	db.Exec("ALTER TABLE user_stats ADD COLUMN played_hard INTEGER NOT NULL DEFAULT 0")
-	db.Exec("ALTER TABLE user_stats ADD COLUMN won_hard INTEGER NOT NULL DEFAULT 0")
-	return nil
-}
-
 func updateCustomName(userID int64, name string) error {
-	_, err := db.Exec("UPDATE users SET custom_name = ? WHERE id = ?", name, userID)
+	err := store.SetCustomName(userID, name)
+	invalidateLeaderboard()
 	return err
 }
 
 func insertGameResult(userID int64, date string, won bool, guesses *int, hardMode bool) error {
-	_, err := db.Exec(`
-		INSERT INTO game_results (user_id, date, won, guesses, hard_mode)
-		VALUES (?, ?, ?, ?, ?)
-		ON CONFLICT(user_id, date) DO NOTHING
-	`, userID, date, won, guesses, hardMode)
-	return err
+	inserted, err := store.InsertResult(userID, date, won, guesses, hardMode)
+	if err != nil || !inserted {
+		return err
+	}
+	// Leaderboards pick the result up when their snapshot expires
+	return refreshUserStats(db, userID)
 }
@@ -0,0 +1,81 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// valid-words.js is the same guess dictionary the browser uses, embedded so
+// the server accepts exactly the words the client does.
+//
+//go:embed valid-words.js
+var validWordsJS string
+
+var (
+	validWords  = parseValidWords(validWordsJS)
+	answerWords = wordSet(dailyWords)
+)
+
+// parseValidWords extracts the VALID_WORDS set literal from valid-words.js.
+func parseValidWords(src string) map[string]struct{} {
+	start := strings.Index(src, "const VALID_WORDS = new Set([")
+	if start == -1 {
+		panic("dictionary: VALID_WORDS not found in valid-words.js")
+	}
+	matches := regexp.MustCompile(`"([A-Z]{6})"`).FindAllStringSubmatch(src[start:], -1)
+	if len(matches) == 0 {
+		panic("dictionary: VALID_WORDS is empty")
+	}
+	words := make(map[string]struct{}, len(matches))
+	for _, m := range matches {
+		words[m[1]] = struct{}{}
+	}
+	// Every answer must be guessable, even if the lists drift apart.
+	for _, w := range dailyWords {
+		words[w] = struct{}{}
+	}
+	return words
+}
+
+func wordSet(words []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(words))
+	for _, w := range words {
+		set[w] = struct{}{}
+	}
+	return set
+}
+
+// isValidGuess reports whether word is an accepted guess. word must already
+// be upper-case.
+func isValidGuess(word string) bool {
+	_, ok := validWords[word]
+	return ok
+}
+
+// isAnswerWord reports whether word is in the daily answer list.
+func isAnswerWord(word string) bool {
+	_, ok := answerWords[word]
+	return ok
+}
+
+// validateGuesses normalizes a full guess list and checks every entry is a
+// dictionary word, returning the normalized list.
+func validateGuesses(guesses []string) ([]string, error) {
+	if len(guesses) > maxGuesses {
+		return nil, fmt.Errorf("too many guesses (%d)", len(guesses))
+	}
+	out := make([]string, len(guesses))
+	for i, g := range guesses {
+		word, ok := normalizeGuess(g)
+		if !ok {
+			return nil, fmt.Errorf("guess %d is not 6 letters", i+1)
+		}
+		if !isValidGuess(word) {
+			return nil, fmt.Errorf("guess %d (%s) is not in the dictionary", i+1, word)
+		}
+		out[i] = word
+	}
+	return out, nil
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+const maxFriends = 200
+
+// Friend is the other side of a friendships row. Each friendship is a single
+// row: requester_id asked addressee_id, and accepted is set once the
+// addressee agrees. Either side can remove it.
+type Friend struct {
+	UserID      int64  `json:"user_id"`
+	DisplayName string `json:"display_name"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+	Since       string `json:"since"`
+}
+
+// friendIDs returns the user IDs of a player's accepted friends.
+func friendIDs(userID int64) (map[int64]bool, error) {
+	rows, err := db.Query(`
+		SELECT CASE WHEN requester_id = ? THEN addressee_id ELSE requester_id END
+		FROM friendships
+		WHERE accepted = TRUE AND (requester_id = ? OR addressee_id = ?)
+	`, userID, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := map[int64]bool{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
+}
+
+// decodeFriendTarget reads {"user_id": N} and rejects the caller's own ID.
+func decodeFriendTarget(w http.ResponseWriter, r *http.Request, user *User) (int64, bool) {
+	var body struct {
+		UserID int64 `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return 0, false
+	}
+	if body.UserID == user.ID {
+		http.Error(w, "Cannot friend yourself", http.StatusBadRequest)
+		return 0, false
+	}
+	return body.UserID, true
+}
+
+func handleListFriends(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromRequest(r)
+	if user == nil {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT u.id, COALESCE(u.custom_name, u.display_name), COALESCE(u.avatar_url, ''), f.created_at,
+			f.accepted, f.requester_id = ?
+		FROM friendships f
+		JOIN users u ON u.id = CASE WHEN f.requester_id = ? THEN f.addressee_id ELSE f.requester_id END
+		WHERE f.requester_id = ? OR f.addressee_id = ?
+		ORDER BY f.created_at DESC
+	`, user.ID, user.ID, user.ID, user.ID)
+	if err != nil {
+		http.Error(w, "Failed to query friends", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	friends, incoming, outgoing := []Friend{}, []Friend{}, []Friend{}
+	for rows.Next() {
+		var f Friend
+		var accepted, sentByMe bool
+		if err := rows.Scan(&f.UserID, &f.DisplayName, &f.AvatarURL, &f.Since, &accepted, &sentByMe); err != nil {
+			continue
+		}
+		switch {
+		case accepted:
+			friends = append(friends, f)
+		case sentByMe:
+			outgoing = append(outgoing, f)
+		default:
+			incoming = append(incoming, f)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"friends":  friends,
+		"incoming": incoming,
+		"outgoing": outgoing,
+	})
+}
+
+// handleFriendRequest sends a friend request. If the other player already
+// asked the caller, this accepts theirs instead.
+func handleFriendRequest(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromRequest(r)
+	if user == nil {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+	if user.Banned {
+		http.Error(w, "Account is banned", http.StatusForbidden)
+		return
+	}
+	targetID, ok := decodeFriendTarget(w, r, user)
+	if !ok {
+		return
+	}
+
+	target, err := store.GetUser(targetID)
+	if err != nil || target.Banned {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	var count int
+	db.QueryRow("SELECT COUNT(*) FROM friendships WHERE requester_id = ? OR addressee_id = ?", user.ID, user.ID).Scan(&count)
+	if count >= maxFriends {
+		http.Error(w, "Too many friends and pending requests", http.StatusConflict)
+		return
+	}
+
+	result, err := db.Exec(
+		"UPDATE friendships SET accepted = TRUE WHERE requester_id = ? AND addressee_id = ?",
+		targetID, user.ID,
+	)
+	if err != nil {
+		log.Printf("POST /api/friends/request: db error: %v", err)
+		http.Error(w, "Failed to send request", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		_, err = db.Exec(
+			"INSERT INTO friendships (requester_id, addressee_id) VALUES (?, ?) ON CONFLICT DO NOTHING",
+			user.ID, targetID,
+		)
+		if err != nil {
+			log.Printf("POST /api/friends/request: db error: %v", err)
+			http.Error(w, "Failed to send request", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	var accepted bool
+	db.QueryRow(`
+		SELECT accepted FROM friendships
+		WHERE (requester_id = ? AND addressee_id = ?) OR (requester_id = ? AND addressee_id = ?)
+	`, user.ID, targetID, targetID, user.ID).Scan(&accepted)
+	status := "pending"
+	if accepted {
+		status = "accepted"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "status": status})
+}
+
+func handleAcceptFriend(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromRequest(r)
+	if user == nil {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+	targetID, ok := decodeFriendTarget(w, r, user)
+	if !ok {
+		return
+	}
+
+	result, err := db.Exec(
+		"UPDATE friendships SET accepted = TRUE WHERE requester_id = ? AND addressee_id = ? AND accepted = FALSE",
+		targetID, user.ID,
+	)
+	if err != nil {
+		http.Error(w, "Failed to accept request", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		http.Error(w, "No pending request from that user", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"ok":true}`))
+}
+
+func handleDeclineFriend(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromRequest(r)
+	if user == nil {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+	targetID, ok := decodeFriendTarget(w, r, user)
+	if !ok {
+		return
+	}
+
+	result, err := db.Exec(
+		"DELETE FROM friendships WHERE requester_id = ? AND addressee_id = ? AND accepted = FALSE",
+		targetID, user.ID,
+	)
+	if err != nil {
+		http.Error(w, "Failed to decline request", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		http.Error(w, "No pending request from that user", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"ok":true}`))
+}
+
+// handleRemoveFriend unfriends a player or cancels a request the caller sent.
+func handleRemoveFriend(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromRequest(r)
+	if user == nil {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+	targetID, ok := decodeFriendTarget(w, r, user)
+	if !ok {
+		return
+	}
+
+	_, err := db.Exec(`
+		DELETE FROM friendships
+		WHERE (requester_id = ? AND addressee_id = ?)
+			OR (requester_id = ? AND addressee_id = ? AND accepted = TRUE)
+	`, user.ID, targetID, targetID, user.ID)
+	if err != nil {
+		http.Error(w, "Failed to remove friend", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"ok":true}`))
+}
+
+// handleGetFriendsLeaderboard ranks the caller and their friends. It accepts
+// the same window parameters as /api/leaderboard.
+func handleGetFriendsLeaderboard(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromRequest(r)
+	if user == nil {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	win, err := parseLeaderboardWindow(r, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entries, err := getLeaderboard(win)
+	if err != nil {
+		log.Printf("GET /api/friends/leaderboard: %v", err)
+		http.Error(w, "Failed to query leaderboard", http.StatusInternalServerError)
+		return
+	}
+	ids, err := friendIDs(user.ID)
+	if err != nil {
+		http.Error(w, "Failed to query leaderboard", http.StatusInternalServerError)
+		return
+	}
+	ids[user.ID] = true
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"leaderboard": filterLeaderboard(entries, ids),
+		"period":      win.Period,
+		"from":        win.From,
+		"to":          win.To,
+	})
+}
+
+// FriendGame is a friend's finished game shown as tile colours only.
+type FriendGame struct {
+	UserID      int64      `json:"user_id"`
+	DisplayName string     `json:"display_name"`
+	AvatarURL   string     `json:"avatar_url,omitempty"`
+	Won         bool       `json:"won"`
+	Guesses     int        `json:"guesses"`
+	HardMode    bool       `json:"hard_mode"`
+	Grid        [][]string `json:"grid"`
+}
+
+// handleGetFriendsToday lists friends who finished a day's puzzle with their
+// colour grids. Grids never include letters, and are only shown once the
+// caller has finished the same puzzle so they can't be used as hints.
+func handleGetFriendsToday(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromRequest(r)
+	if user == nil {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	date := r.URL.Query().Get("date")
+	if date == "" {
+		http.Error(w, "Date is required", http.StatusBadRequest)
+		return
+	}
+	puzzle, err := puzzleForDate(date)
+	if err != nil {
+		http.Error(w, "Invalid puzzle date", http.StatusBadRequest)
+		return
+	}
+
+	own, err := store.GetProgress(user.ID, date)
+	if err != nil || !own.GameOver {
+		http.Error(w, "Finish this puzzle to see your friends' games", http.StatusForbidden)
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT u.id, COALESCE(u.custom_name, u.display_name), COALESCE(u.avatar_url, ''), p.guesses, p.won, p.hard_mode
+		FROM game_progress p
+		JOIN users u ON u.id = p.user_id
+		JOIN friendships f ON f.accepted = TRUE AND (
+			(f.requester_id = ? AND f.addressee_id = p.user_id) OR
+			(f.addressee_id = ? AND f.requester_id = p.user_id)
+		)
+		WHERE p.date = ? AND p.game_over = TRUE AND u.banned = FALSE
+		ORDER BY u.id ASC
+	`, user.ID, user.ID, date)
+	if err != nil {
+		log.Printf("GET /api/friends/today: db error: %v", err)
+		http.Error(w, "Failed to query friends", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	games := []FriendGame{}
+	for rows.Next() {
+		var g FriendGame
+		var guessesJSON string
+		if err := rows.Scan(&g.UserID, &g.DisplayName, &g.AvatarURL, &guessesJSON, &g.Won, &g.HardMode); err != nil {
+			continue
+		}
+		var guesses []string
+		json.Unmarshal([]byte(guessesJSON), &guesses)
+		guesses, err := validateGuesses(guesses)
+		if err != nil {
+			continue
+		}
+		g.Guesses = len(guesses)
+		g.Grid = [][]string{}
+		for _, guess := range guesses {
+			g.Grid = append(g.Grid, scoreGuess(guess, puzzle.Answer()))
+		}
+		games = append(games, g)
+	}
+
+	sort.SliceStable(games, func(i, j int) bool {
+		if games[i].Won != games[j].Won {
+			return games[i].Won
+		}
+		return games[i].Guesses < games[j].Guesses
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"date": date, "games": games})
+}
@@ -3,20 +3,23 @@ package main
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"regexp"
-	"strconv"
 	"strings"
 	"time"
 	"unicode/utf8"
 )
 
 type GameProgress struct {
-	Guesses  []string `json:"guesses"`
-	HardMode bool     `json:"hardMode"`
-	GameOver bool     `json:"gameOver"`
-	Won      bool     `json:"won"`
+	Guesses  []string   `json:"guesses"`
+	Results  [][]string `json:"results,omitempty"`
+	HardMode bool       `json:"hardMode"`
+	GameOver bool       `json:"gameOver"`
+	Won      bool       `json:"won"`
+	Answer   string     `json:"answer,omitempty"`
 }
 
 func handleGetGameState(w http.ResponseWriter, r *http.Request) {
@@ -34,14 +37,7 @@ func handleGetGameState(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var guessesJSON string
-	var hardMode, gameOver, won bool
-
-	err := db.QueryRow(
-		"SELECT guesses, hard_mode, game_over, won FROM game_progress WHERE user_id = ? AND date = ?",
-		user.ID, date,
-	).Scan(&guessesJSON, &hardMode, &gameOver, &won)
-
+	progress, err := store.GetProgress(user.ID, date)
 	if err != nil {
 		// No progress found — return empty state
 		w.Header().Set("Content-Type", "application/json")
@@ -49,18 +45,173 @@ func handleGetGameState(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var guesses []string
-	if err := json.Unmarshal([]byte(guessesJSON), &guesses); err != nil {
-		guesses = []string{}
+	// Tile colours let the client redraw the board without knowing the word;
+	// the word itself is only revealed once the game is over.
+	if puzzle, err := puzzleForDate(date); err == nil {
+		for _, g := range progress.Guesses {
+			if g, ok := normalizeGuess(g); ok {
+				progress.Results = append(progress.Results, scoreGuess(g, puzzle.Answer()))
+			}
+		}
+		if progress.GameOver {
+			progress.Answer = puzzle.Answer()
+		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(GameProgress{
-		Guesses:  guesses,
-		HardMode: hardMode,
-		GameOver: gameOver,
-		Won:      won,
-	})
+	json.NewEncoder(w).Encode(progress)
+}
+
+// GuessResponse is returned by POST /api/guess.
+type GuessResponse struct {
+	Result    []string `json:"result"`
+	Guesses   int      `json:"guesses"`
+	GameOver  bool     `json:"gameOver"`
+	Won       bool     `json:"won"`
+	Answer    string   `json:"answer,omitempty"`
+	TzWarning bool     `json:"tz_warning,omitempty"`
+}
+
+// guessError rejects a guess with a status and message for the client.
+type guessError struct {
+	status int
+	msg    string
+}
+
+func (e *guessError) Error() string { return e.msg }
+
+// handleGuess scores a single guess against the day's answer. For a signed-in
+// player it is appended to their game_progress and the result is recorded
+// once the game ends. Signed-out players keep their game in the browser:
+// they send the guesses so far as previous, and nothing is stored.
+func handleGuess(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromRequest(r)
+	if user != nil && user.Banned {
+		http.Error(w, "Account is banned", http.StatusForbidden)
+		return
+	}
+
+	var body struct {
+		Date       string   `json:"date"`
+		Guess      string   `json:"guess"`
+		Previous   []string `json:"previous"`
+		HardMode   bool     `json:"hardMode"`
+		ClientTime string   `json:"client_time"`
+		TzOffset   *int     `json:"tz_offset"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if body.Date == "" {
+		http.Error(w, "Date is required", http.StatusBadRequest)
+		return
+	}
+	puzzle, err := currentPuzzle(body.Date)
+	if err != nil {
+		log.Printf("POST /api/guess: %v", err)
+		http.Error(w, "Invalid puzzle date", http.StatusBadRequest)
+		return
+	}
+
+	guess, ok := normalizeGuess(body.Guess)
+	if !ok {
+		http.Error(w, "Guess must be 6 letters", http.StatusBadRequest)
+		return
+	}
+	if !isValidGuess(guess) {
+		http.Error(w, "Not a valid word", http.StatusBadRequest)
+		return
+	}
+
+	var outcome *GameOutcome
+	if user == nil {
+		previous, verr := validateGuesses(body.Previous)
+		if verr != nil {
+			http.Error(w, "Invalid guesses: "+verr.Error(), http.StatusBadRequest)
+			return
+		}
+		_, outcome, err = playGuess(puzzle, previous, guess, body.HardMode)
+	} else {
+		err = store.UpdateProgress(user.ID, body.Date, func(p *GameProgress) error {
+			if p.GameOver {
+				return &guessError{http.StatusConflict, "Game is already over"}
+			}
+			previous, err := validateGuesses(p.Guesses)
+			if err != nil {
+				log.Printf("POST /api/guess: user %d: stored game is invalid: %v", user.ID, err)
+				return &guessError{http.StatusConflict, "Saved game is invalid"}
+			}
+			guesses, o, err := playGuess(puzzle, previous, guess, body.HardMode)
+			if err != nil {
+				return err
+			}
+			outcome = o
+			p.Guesses = guesses
+			p.HardMode = body.HardMode
+			p.GameOver = outcome.GameOver
+			p.Won = outcome.Won
+			return nil
+		})
+	}
+	var ge *guessError
+	if errors.As(err, &ge) {
+		http.Error(w, ge.msg, ge.status)
+		return
+	}
+	if err != nil {
+		log.Printf("POST /api/guess: db error: %v", err)
+		http.Error(w, "Failed to save guess", http.StatusInternalServerError)
+		return
+	}
+
+	resp := GuessResponse{
+		Result:   scoreGuess(guess, puzzle.Answer()),
+		Guesses:  outcome.Guesses,
+		GameOver: outcome.GameOver,
+		Won:      outcome.Won,
+	}
+	if resp.GameOver {
+		resp.Answer = puzzle.Answer()
+	}
+
+	if user != nil && outcome.GameOver {
+		if err := recordOutcome(user.ID, body.Date, outcome, body.HardMode); err != nil {
+			log.Printf("POST /api/guess: insert game_result failed: %v", err)
+		}
+	}
+
+	if user != nil && body.ClientTime != "" && body.TzOffset != nil {
+		ip := getClientIP(r)
+		resp.TzWarning = checkTimezone(user.ID, body.ClientTime, *body.TzOffset, ip, "guess")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// playGuess adds guess to a game's validated previous guesses, applying the
+// hard-mode rules if the player has them on, and replays the result.
+func playGuess(puzzle *Puzzle, previous []string, guess string, hardMode bool) ([]string, *GameOutcome, error) {
+	if len(previous) >= maxGuesses {
+		return nil, nil, &guessError{http.StatusConflict, "Game is already over"}
+	}
+	if hardMode {
+		if !hardModeCompliant(previous, puzzle.Answer()) {
+			return nil, nil, &guessError{http.StatusConflict, "Can't enable — previous guesses don't meet hard mode rules"}
+		}
+		if err := checkHardMode(guess, previous, puzzle.Answer()); err != nil {
+			return nil, nil, &guessError{http.StatusBadRequest, err.Error()}
+		}
+	}
+
+	guesses := append(previous[:len(previous):len(previous)], guess)
+	outcome, err := replayGame(puzzle, guesses)
+	if err != nil {
+		return nil, nil, &guessError{http.StatusConflict, "Game is already over"}
+	}
+	return guesses, outcome, nil
 }
 
 func handleSaveProgress(w http.ResponseWriter, r *http.Request) {
@@ -90,19 +241,59 @@ func handleSaveProgress(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Date is required", http.StatusBadRequest)
 		return
 	}
+	puzzle, err := currentPuzzle(body.Date)
+	if err != nil {
+		log.Printf("POST /api/save-progress: user %d: %v", user.ID, err)
+		http.Error(w, "Invalid puzzle date", http.StatusBadRequest)
+		return
+	}
+
+	guesses, err := validateGuesses(body.Guesses)
+	if err != nil {
+		log.Printf("POST /api/save-progress: user %d: rejected guesses: %v", user.ID, err)
+		http.Error(w, "Invalid guesses: "+err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	guessesJSON, _ := json.Marshal(body.Guesses)
+	// Guesses already on record can't be rewritten, only extended
+	if existing, err := store.GetProgress(user.ID, body.Date); err == nil {
+		if !hasPrefix(guesses, existing.Guesses) {
+			log.Printf("POST /api/save-progress: user %d: attempted to rewrite guesses for %s", user.ID, body.Date)
+			http.Error(w, "Saved guesses cannot be changed", http.StatusConflict)
+			return
+		}
+		if existing.GameOver {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"ok":true}`))
+			return
+		}
+	}
 
-	_, err := db.Exec(`
-		INSERT INTO game_progress (user_id, date, guesses, hard_mode, game_over, won)
-		VALUES (?, ?, ?, ?, ?, ?)
-		ON CONFLICT(user_id, date) DO UPDATE SET
-			guesses = excluded.guesses,
-			hard_mode = excluded.hard_mode,
-			game_over = excluded.game_over,
-			won = excluded.won
-	`, user.ID, body.Date, string(guessesJSON), body.HardMode, body.GameOver, body.Won)
+	// The server decides whether the game is over, not the client
+	outcome, err := replayGame(puzzle, guesses)
+	if err != nil {
+		http.Error(w, "Invalid guesses: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if body.GameOver != outcome.GameOver || body.Won != outcome.Won {
+		flagGame(user.ID, body.Date, "save-progress", fmt.Sprintf(
+			"claimed game_over=%v won=%v, replay game_over=%v won=%v",
+			body.GameOver, body.Won, outcome.GameOver, outcome.Won))
+	}
+	// Hard mode is stripped rather than rejected so the guesses still save;
+	// the client only lets players enable it when canEnableHardMode() passes,
+	// so a mismatch here means the request didn't come from the game.
+	hardMode := body.HardMode && outcome.HardModeValid
+	if body.HardMode && !outcome.HardModeValid {
+		flagGame(user.ID, body.Date, "save-progress", "claimed hard mode but guesses break hard-mode rules")
+	}
 
+	err = store.SaveProgress(user.ID, body.Date, &GameProgress{
+		Guesses:  guesses,
+		HardMode: hardMode,
+		GameOver: outcome.GameOver,
+		Won:      outcome.Won,
+	})
 	if err != nil {
 		log.Printf("POST /api/save-progress: db error: %v", err)
 		http.Error(w, "Failed to save progress", http.StatusInternalServerError)
@@ -110,16 +301,11 @@ func handleSaveProgress(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// If game is over, ensure a game_results entry exists (don't rely on client)
-	if body.GameOver {
-		guessCount := len(body.Guesses)
-		var guessPtr *int
-		if body.Won && guessCount > 0 {
-			guessPtr = &guessCount
-		}
-		if err := insertGameResult(user.ID, body.Date, body.Won, guessPtr, body.HardMode); err != nil {
+	if outcome.GameOver {
+		if err := recordOutcome(user.ID, body.Date, outcome, hardMode); err != nil {
 			log.Printf("POST /api/save-progress: auto-insert game_result failed: %v", err)
 		} else {
-			log.Printf("POST /api/save-progress: auto-inserted game_result for user %d, date=%s, won=%v, guesses=%d", user.ID, body.Date, body.Won, guessCount)
+			log.Printf("POST /api/save-progress: auto-inserted game_result for user %d, date=%s, won=%v, guesses=%d", user.ID, body.Date, outcome.Won, outcome.Guesses)
 		}
 	}
 
@@ -130,12 +316,15 @@ func handleSaveProgress(w http.ResponseWriter, r *http.Request) {
 		tzWarning = checkTimezone(user.ID, body.ClientTime, *body.TzOffset, ip, "save-progress")
 	}
 
-	log.Printf("POST /api/save-progress: saved for user %d, date=%s, %d guesses", user.ID, body.Date, len(body.Guesses))
+	log.Printf("POST /api/save-progress: saved for user %d, date=%s, %d guesses", user.ID, body.Date, len(guesses))
 	w.Header().Set("Content-Type", "application/json")
 	resp := map[string]interface{}{"ok": true}
 	if tzWarning {
 		resp["tz_warning"] = true
 	}
+	if body.HardMode && !hardMode {
+		resp["hard_mode_revoked"] = true
+	}
 	json.NewEncoder(w).Encode(resp)
 }
 
@@ -158,46 +347,25 @@ func handleGetUserStats(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var played, won, playedHard, wonHard, currentStreak, maxStreak int
-	var distributionJSON string
-	var lastDate *string
-	var hardModeVal bool
-
-	err := db.QueryRow(
-		"SELECT played, won, played_hard, won_hard, current_streak, max_streak, distribution, last_date, hard_mode FROM user_stats WHERE user_id = ?",
-		user.ID,
-	).Scan(&played, &won, &playedHard, &wonHard, &currentStreak, &maxStreak, &distributionJSON, &lastDate, &hardModeVal)
-
+	stats, err := store.GetUserStats(user.ID)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(UserStats{Distribution: []int{0, 0, 0, 0, 0, 0}})
 		return
 	}
 
-	var distribution []int
-	if err := json.Unmarshal([]byte(distributionJSON), &distribution); err != nil {
-		distribution = []int{0, 0, 0, 0, 0, 0}
-	}
-
-	ld := ""
-	if lastDate != nil {
-		ld = *lastDate
+	// The stored streak was correct when the last result came in, but a
+	// missed day since then breaks it without any new row being written.
+	if current, _, err := userStreaks(user.ID); err == nil {
+		stats.CurrentStreak = current
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(UserStats{
-		Played:        played,
-		Won:           won,
-		PlayedHard:    playedHard,
-		WonHard:       wonHard,
-		CurrentStreak: currentStreak,
-		MaxStreak:     maxStreak,
-		Distribution:  distribution,
-		LastDate:      ld,
-		HardMode:      hardModeVal,
-	})
+	json.NewEncoder(w).Encode(stats)
 }
 
+// handleSaveUserStats only stores preferences. The stats themselves are
+// derived from game_results and can't be written by the client.
 func handleSaveUserStats(w http.ResponseWriter, r *http.Request) {
 	user := getUserFromRequest(r)
 	if user == nil {
@@ -205,30 +373,15 @@ func handleSaveUserStats(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var body UserStats
+	var body struct {
+		HardMode bool `json:"hardMode"`
+	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	distributionJSON, _ := json.Marshal(body.Distribution)
-
-	_, err := db.Exec(`
-		INSERT INTO user_stats (user_id, played, won, played_hard, won_hard, current_streak, max_streak, distribution, last_date, hard_mode)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
-		ON CONFLICT(user_id) DO UPDATE SET
-			played = excluded.played,
-			won = excluded.won,
-			played_hard = excluded.played_hard,
-			won_hard = excluded.won_hard,
-			current_streak = excluded.current_streak,
-			max_streak = excluded.max_streak,
-			distribution = excluded.distribution,
-			last_date = excluded.last_date,
-			hard_mode = excluded.hard_mode
-	`, user.ID, body.Played, body.Won, body.PlayedHard, body.WonHard, body.CurrentStreak, body.MaxStreak, string(distributionJSON), body.LastDate, body.HardMode)
-
-	if err != nil {
+	if err := store.SetHardModePreference(user.ID, body.HardMode); err != nil {
 		log.Printf("POST /api/user-stats: db error: %v", err)
 		http.Error(w, "Failed to save stats", http.StatusInternalServerError)
 		return
@@ -309,18 +462,15 @@ func handleUpdateDisplayName(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to update name", http.StatusInternalServerError)
 		return
 	}
+	audit(r, user.ID, "name.change", user.ID, map[string]interface{}{"custom_name": user.CustomName}, map[string]interface{}{"custom_name": name})
 
 	w.Header().Set("Content-Type", "application/json")
 	w.Write([]byte(`{"ok":true}`))
 }
 
-// Admin: ban/unban a user. Only user ID 1 (first registered user) can do this.
+// Admin: ban/unban a user. Staff can only ban players with a lower role.
 func handleBanUser(w http.ResponseWriter, r *http.Request) {
 	admin := getUserFromRequest(r)
-	if admin == nil || admin.ID != 1 {
-		http.Error(w, "Forbidden", http.StatusForbidden)
-		return
-	}
 
 	var body struct {
 		UserID int64 `json:"user_id"`
@@ -335,63 +485,29 @@ func handleBanUser(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Cannot ban yourself", http.StatusBadRequest)
 		return
 	}
+	target, err := store.GetUser(body.UserID)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if roleRank[target.Role] >= roleRank[admin.Role] {
+		http.Error(w, "Cannot ban a staff member with your role or above", http.StatusForbidden)
+		return
+	}
 
-	var err error
+	action := "user.ban"
 	if body.Ban {
 		err = banUser(body.UserID)
 	} else {
+		action = "user.unban"
 		err = unbanUser(body.UserID)
 	}
 	if err != nil {
 		http.Error(w, "Failed to update ban status", http.StatusInternalServerError)
 		return
 	}
+	audit(r, admin.ID, action, body.UserID, map[string]interface{}{"banned": target.Banned}, map[string]interface{}{"banned": body.Ban})
 
 	w.Header().Set("Content-Type", "application/json")
 	w.Write([]byte(`{"ok":true}`))
 }
-
-func handleListUsers(w http.ResponseWriter, r *http.Request) {
-	admin := getUserFromRequest(r)
-	if admin == nil || admin.ID != 1 {
-		http.Error(w, "Forbidden", http.StatusForbidden)
-		return
-	}
-
-	limitStr := r.URL.Query().Get("limit")
-	limit := 100
-	if limitStr != "" {
-		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 500 {
-			limit = l
-		}
-	}
-
-	rows, err := db.Query("SELECT id, provider, display_name, COALESCE(custom_name, ''), COALESCE(avatar_url, ''), banned FROM users ORDER BY id LIMIT ?", limit)
-	if err != nil {
-		http.Error(w, "Failed to query users", http.StatusInternalServerError)
-		return
-	}
-	defer rows.Close()
-
-	type userEntry struct {
-		ID          int64  `json:"id"`
-		Provider    string `json:"provider"`
-		DisplayName string `json:"display_name"`
-		CustomName  string `json:"custom_name,omitempty"`
-		AvatarURL   string `json:"avatar_url,omitempty"`
-		Banned      bool   `json:"banned"`
-	}
-
-	var users []userEntry
-	for rows.Next() {
-		var u userEntry
-		rows.Scan(&u.ID, &u.Provider, &u.DisplayName, &u.CustomName, &u.AvatarURL, &u.Banned)
-		users = append(users, u)
-	}
-	if users == nil {
-		users = []userEntry{}
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{"users": users})
-}
@@ -1,15 +1,17 @@
 const WORD_LENGTH = 6;
 const MAX_GUESSES = 6;
 
-let targetWord = '';
 let currentGuess = '';
 let currentRow = 0;
 let gameOver = false;
 let gameState = null;
 let hardMode = false;
+let submitting = false;
 
 
-// Initialize game
+// Initialize game. The answer is never sent to the browser while a game is
+// in progress: guesses are scored by POST /api/guess, and the tile colours
+// are kept in gameState.results so the board can be redrawn.
 async function initGame() {
     loadGameState();
     loadHardMode();
@@ -22,81 +24,20 @@ async function initGame() {
     if (!gameState || gameState.date !== today) {
         startNewGame();
     } else {
-        // Restore existing game
-        targetWord = getTodaysWord();
-        currentRow = gameState.guesses.length;
-        gameOver = gameState.gameOver;
-
-        // Restore board
-        gameState.guesses.forEach((guess, i) => {
-            restoreGuess(i, guess);
-        });
-
-        // Restore keyboard
-        gameState.guesses.forEach(guess => {
-            const result = checkGuess(guess);
-            updateKeyboard(guess, result);
-        });
-
-        if (gameOver) {
-            if (gameState.won) {
-                showMessage('You already solved today\'s puzzle', true);
-                showShareButton();
-            } else {
-                // Show the answer persistently for returning users who lost
-                showMessage(`The word was ${targetWord}`, true);
-                showShareButton();
-            }
+        // Games saved before colours were stored are rescored by the server;
+        // signed-in players get theirs from /api/game-state below
+        const signedIn = typeof currentUser !== 'undefined' && currentUser;
+        if (!Array.isArray(gameState.results) || gameState.results.length !== gameState.guesses.length) {
+            if (signedIn) gameState.results = [];
+            else await rescoreGuesses();
         }
+        restoreBoard();
     }
 
     // If signed in, server state is authoritative — replace local state
     if (typeof currentUser !== 'undefined' && currentUser) {
         await syncStatsFromServer();
-        try {
-            const resp = await fetch(`/api/game-state?date=${getDateString()}`);
-            if (resp.ok) {
-                const serverState = await resp.json();
-                // Always apply server state for logged-in users
-                const serverGuesses = serverState.guesses || [];
-                gameState.guesses = serverGuesses;
-                gameState.gameOver = serverState.gameOver || false;
-                gameState.won = serverState.won || false;
-                hardMode = serverState.hardMode || false;
-                localStorage.setItem('hardMode', hardMode);
-                currentRow = gameState.guesses.length;
-                gameOver = gameState.gameOver;
-                targetWord = getTodaysWord();
-                saveGameState();
-
-                // Re-render board
-                createBoard();
-                gameState.guesses.forEach((guess, i) => {
-                    restoreGuess(i, guess);
-                });
-                resetKeyboard();
-                gameState.guesses.forEach(guess => {
-                    const result = checkGuess(guess);
-                    updateKeyboard(guess, result);
-                });
-
-                // Update hard mode toggle UI
-                const toggle = document.getElementById('hardModeToggle');
-                if (toggle) toggle.classList.toggle('active', hardMode);
-
-                if (gameOver) {
-                    if (gameState.won) {
-                        showMessage('You already solved today\'s puzzle', true);
-                        showShareButton();
-                    } else {
-                        showMessage(`The word was ${targetWord}`, true);
-                        showShareButton();
-                    }
-                }
-            }
-        } catch (e) {
-            // Silent fail — localStorage state is the fallback
-        }
+        await loadServerGame();
     }
 
     // Update timer
@@ -104,8 +45,99 @@ async function initGame() {
     setInterval(updateTimer, 1000);
 }
 
+// loadServerGame replaces the local game with a signed-in player's saved one.
+async function loadServerGame() {
+    try {
+        const resp = await fetch(`/api/game-state?date=${getDateString()}`);
+        if (!resp.ok) return;
+        const serverState = await resp.json();
+        gameState.guesses = serverState.guesses || [];
+        gameState.results = serverState.results || [];
+        gameState.gameOver = serverState.gameOver || false;
+        gameState.won = serverState.won || false;
+        gameState.answer = serverState.answer || null;
+        hardMode = serverState.hardMode || false;
+        localStorage.setItem('hardMode', hardMode);
+        saveGameState();
+
+        // Update hard mode toggle UI
+        const toggle = document.getElementById('hardModeToggle');
+        if (toggle) toggle.classList.toggle('active', hardMode);
+
+        restoreBoard();
+    } catch (e) {
+        // Silent fail — localStorage state is the fallback
+    }
+}
+
+// restoreBoard redraws the board and keyboard from gameState.
+function restoreBoard() {
+    currentGuess = '';
+    currentRow = gameState.guesses.length;
+    gameOver = gameState.gameOver;
+
+    createBoard();
+    resetKeyboard();
+    gameState.guesses.forEach((guess, i) => {
+        const result = gameState.results[i];
+        if (!result) return;
+        restoreGuess(i, guess, result);
+        updateKeyboard(guess, result);
+    });
+
+    if (gameOver) {
+        if (gameState.won) {
+            showMessage('You already solved today\'s puzzle', true);
+        } else {
+            // Show the answer persistently for returning users who lost
+            showMessage(gameState.answer ? `The word was ${gameState.answer}` : 'Better luck tomorrow', true);
+        }
+        showShareButton();
+    }
+}
+
+// rescoreGuesses asks the server to colour a signed-out player's saved
+// guesses one at a time, for games saved before colours were stored.
+async function rescoreGuesses() {
+    const results = [];
+    try {
+        for (let i = 0; i < gameState.guesses.length; i++) {
+            const data = await postGuess(gameState.guesses[i], gameState.guesses.slice(0, i), false);
+            results.push(data.result);
+            if (data.gameOver) gameState.answer = data.answer || null;
+        }
+    } catch (e) {
+        // Leave the rows uncoloured; signed-in players get them from the server
+    }
+    gameState.results = results;
+    saveGameState();
+}
+
+// postGuess scores a guess with the server. Signed-in players' games are kept
+// server-side; signed-out players send their earlier guesses with each one.
+async function postGuess(guess, previous, hard) {
+    const signedIn = typeof currentUser !== 'undefined' && currentUser;
+    const resp = await fetch('/api/guess', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({
+            date: gameState.date,
+            guess: guess,
+            previous: signedIn ? undefined : previous,
+            hardMode: hard,
+            client_time: new Date().toISOString(),
+            tz_offset: new Date().getTimezoneOffset()
+        })
+    });
+    if (!resp.ok) {
+        const err = new Error((await resp.text()).trim() || 'Could not check that guess');
+        err.status = resp.status;
+        throw err;
+    }
+    return resp.json();
+}
+
 function startNewGame() {
-    targetWord = getTodaysWord();
     currentGuess = '';
     currentRow = 0;
     gameOver = false;
@@ -113,8 +145,10 @@ function startNewGame() {
     gameState = {
         date: getDateString(),
         guesses: [],
+        results: [],
         gameOver: false,
-        won: false
+        won: false,
+        answer: null
     };
 
     saveGameState();
@@ -142,8 +176,7 @@ function createBoard() {
     }
 }
 
-function restoreGuess(rowIndex, word) {
-    const result = checkGuess(word);
+function restoreGuess(rowIndex, word, result) {
     for (let i = 0; i < WORD_LENGTH; i++) {
         const tile = document.getElementById(`tile-${rowIndex}-${i}`);
         tile.textContent = word[i];
@@ -167,7 +200,7 @@ function attachKeyboard() {
 }
 
 function handleKey(key) {
-    if (gameOver) return;
+    if (gameOver || submitting) return;
 
     if (key === 'ENTER') {
         if (currentGuess.length === WORD_LENGTH) {
@@ -195,7 +228,7 @@ function updateCurrentRow() {
     }
 }
 
-function submitGuess() {
+async function submitGuess() {
     const guess = currentGuess;
 
     // Validate word against local dictionary
@@ -213,10 +246,37 @@ function submitGuess() {
         return;
     }
 
-    // Save guess
-    gameState.guesses.push(guess);
+    // The server scores the guess, records it for signed-in players and
+    // records their result when it ends the game
+    let data;
+    submitting = true;
+    try {
+        data = await postGuess(guess, gameState.guesses, hardMode);
+    } catch (e) {
+        showMessage(e.status ? e.message : 'Network error — try again');
+        shakeRow();
+        return;
+    } finally {
+        submitting = false;
+    }
+    if (data.tz_warning) showTzWarning();
 
-    const result = checkGuess(guess);
+    // The game moved on elsewhere (another tab or device): catch up with it
+    if (data.guesses !== gameState.guesses.length + 1) {
+        await loadServerGame();
+        return;
+    }
+
+    const result = data.result;
+    gameState.guesses.push(guess);
+    gameState.results.push(result);
+    if (data.gameOver) {
+        gameOver = true;
+        gameState.gameOver = true;
+        gameState.won = data.won;
+        gameState.answer = data.answer || null;
+    }
+    saveGameState();
 
     // Animate tiles
     for (let i = 0; i < WORD_LENGTH; i++) {
@@ -233,65 +293,25 @@ function submitGuess() {
 
     // Check win/lose
     const guessNumber = currentRow + 1; // Capture before currentRow gets incremented
-    if (guess === targetWord) {
+    if (data.gameOver && data.won) {
         setTimeout(() => {
-            gameOver = true;
-            gameState.gameOver = true;
-            gameState.won = true;
-            saveGameState();
-            saveProgressToServer();
             updateStats(true, guessNumber);
             bounceRow();
             showShareButton();
             showWinModal(guessNumber);
-            if (typeof submitResultToAPI === 'function') submitResultToAPI(true, guessNumber, hardMode);
+            if (typeof onResultRecorded === 'function') onResultRecorded();
         }, WORD_LENGTH * 200 + 500);
-    } else if (currentRow === MAX_GUESSES - 1) {
+    } else if (data.gameOver) {
         setTimeout(() => {
-            gameOver = true;
-            gameState.gameOver = true;
-            gameState.won = false;
-            saveGameState();
-            saveProgressToServer();
             updateStats(false);
             showShareButton();
-            showLossModal(targetWord);
-            if (typeof submitResultToAPI === 'function') submitResultToAPI(false, null, hardMode);
+            showLossModal(gameState.answer);
+            if (typeof onResultRecorded === 'function') onResultRecorded();
         }, WORD_LENGTH * 200 + 500);
     }
 
     currentRow++;
     currentGuess = '';
-    saveGameState();
-    saveProgressToServer();
-}
-
-
-function checkGuess(guess) {
-    const result = Array(WORD_LENGTH).fill('absent');
-    const targetLetters = targetWord.split('');
-    const guessLetters = guess.split('');
-
-    // First pass: mark correct letters
-    for (let i = 0; i < WORD_LENGTH; i++) {
-        if (guessLetters[i] === targetLetters[i]) {
-            result[i] = 'correct';
-            targetLetters[i] = null;
-        }
-    }
-
-    // Second pass: mark present letters
-    for (let i = 0; i < WORD_LENGTH; i++) {
-        if (result[i] === 'correct') continue;
-
-        const index = targetLetters.indexOf(guessLetters[i]);
-        if (index !== -1) {
-            result[i] = 'present';
-            targetLetters[index] = null;
-        }
-    }
-
-    return result;
 }
 
 function updateKeyboard(guess, result) {
@@ -355,9 +375,11 @@ function saveGameState() {
 
 let tzWarningShown = false;
 
+// saveProgressToServer resolves once the save has finished, whether or not
+// it succeeded.
 function saveProgressToServer() {
-    if (typeof currentUser === 'undefined' || !currentUser || !gameState) return;
-    fetch('/api/save-progress', {
+    if (typeof currentUser === 'undefined' || !currentUser || !gameState) return Promise.resolve();
+    return fetch('/api/save-progress', {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({
@@ -369,7 +391,7 @@ function saveProgressToServer() {
             client_time: new Date().toISOString(),
             tz_offset: new Date().getTimezoneOffset()
         })
-    }).then(r => r.json()).then(data => {
+    }).then(r => r.ok ? r.json() : {}).then(data => {
         if (data.tz_warning) showTzWarning();
     }).catch(() => {});
 }
@@ -414,24 +436,13 @@ async function syncStatsFromServer() {
     }
 }
 
+// Stats are computed server-side from results; only the preference is saved
 function saveStatsToServer() {
     if (typeof currentUser === 'undefined' || !currentUser) return;
-    const stats = JSON.parse(localStorage.getItem('stats'));
-    if (!stats) return;
     fetch('/api/user-stats', {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
-        body: JSON.stringify({
-            played: stats.played,
-            won: stats.won,
-            playedHard: stats.playedHard || 0,
-            wonHard: stats.wonHard || 0,
-            currentStreak: stats.currentStreak,
-            maxStreak: stats.maxStreak,
-            distribution: stats.distribution,
-            lastDate: stats.lastDate || '',
-            hardMode: hardMode
-        })
+        body: JSON.stringify({ hardMode: hardMode })
     }).catch(() => {});
 }
 
@@ -455,7 +466,8 @@ function updateStats(won, guesses = null) {
         if (hardMode) stats.wonHard++;
         stats.distribution[guesses - 1]++;
 
-        // Update streak
+        // Update streak locally; signed-in players get the server's
+        // calendar-aware streak once their result is recorded
         const today = getDateString();
         const yesterday = new Date();
         yesterday.setDate(yesterday.getDate() - 1);
@@ -542,8 +554,7 @@ function shareResults(button) {
 
     const guessCount = gameState.won ? gameState.guesses.length : 'X';
     const hardIndicator = hardMode ? ' (Hard Mode)' : '';
-    const emoji = gameState.guesses.map(guess => {
-        const result = checkGuess(guess);
+    const emoji = gameState.results.map(result => {
         return result.map(r => {
             if (r === 'correct') return '🟩';
             if (r === 'present') return '🟨';
@@ -551,7 +562,9 @@ function shareResults(button) {
         }).join('');
     }).join('\n');
 
-    const text = `Wordle Six ${guessCount}/${MAX_GUESSES}${hardIndicator}\n\n${emoji}\n\nhttps://wordle-six.tomtom.fyi`;
+    // The server points og:url at this instance's public URL
+    const siteURL = document.querySelector('meta[property="og:url"]').content.replace(/\/$/, '');
+    const text = `Wordle Six ${guessCount}/${MAX_GUESSES}${hardIndicator}\n\n${emoji}\n\n${siteURL}`;
 
     // Only use native share on mobile (touch devices), clipboard everywhere else
     const isMobile = 'ontouchstart' in window || navigator.maxTouchPoints > 0;
@@ -613,22 +626,12 @@ function toggleHardMode() {
 function canEnableHardMode() {
     if (!gameState || gameState.guesses.length <= 1) return { valid: true };
 
-    const allGuesses = [...gameState.guesses];
-    const savedGuesses = gameState.guesses;
-    const savedHardMode = hardMode;
-
-    hardMode = true;
-    for (let i = 1; i < allGuesses.length; i++) {
-        gameState.guesses = allGuesses.slice(0, i);
-        const result = checkHardMode(allGuesses[i]);
+    for (let i = 1; i < gameState.guesses.length; i++) {
+        const result = checkHardModeAgainst(gameState.guesses[i], gameState.guesses.slice(0, i), gameState.results);
         if (!result.valid) {
-            gameState.guesses = savedGuesses;
-            hardMode = savedHardMode;
             return { valid: false, message: `Can't enable — previous guesses don't meet hard mode rules` };
         }
     }
-    gameState.guesses = savedGuesses;
-    hardMode = savedHardMode;
     return { valid: true };
 }
 
@@ -652,16 +655,21 @@ function checkHardMode(guess) {
     if (!hardMode || !gameState || gameState.guesses.length === 0) {
         return { valid: true };
     }
+    return checkHardModeAgainst(guess, gameState.guesses, gameState.results);
+}
 
+// checkHardModeAgainst checks guess against the hints revealed by previous
+// guesses, whose tile colours are the matching entries of results.
+function checkHardModeAgainst(guess, previous, results) {
     // Build up known constraints from all previous guesses
     const requiredPositions = {}; // position -> letter (green)
     const requiredLetters = new Set(); // must be in guess (yellow)
     const absentLetters = new Set(); // confirmed not in word
     const excludedPositions = {}; // position -> Set of letters that can't be there (yellow)
 
-    for (const prev of gameState.guesses) {
-        const result = checkGuess(prev);
-        const prevLetters = prev.split('');
+    for (let g = 0; g < previous.length; g++) {
+        const result = results[g] || [];
+        const prevLetters = previous[g].split('');
 
         // First collect greens and yellows
         for (let i = 0; i < WORD_LENGTH; i++) {
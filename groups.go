@@ -0,0 +1,490 @@
+package main
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	maxGroupsPerUser = 20
+	maxGroupMembers  = 200
+)
+
+type Group struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	InviteCode  string `json:"invite_code"`
+	MemberCount int    `json:"member_count"`
+	IsAdmin     bool   `json:"is_admin"`
+}
+
+type GroupMember struct {
+	UserID      int64  `json:"user_id"`
+	DisplayName string `json:"display_name"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+	IsAdmin     bool   `json:"is_admin"`
+	JoinedAt    string `json:"joined_at"`
+}
+
+// Invite codes avoid characters that are easy to misread (0/O, 1/I/L).
+const inviteCodeAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+
+func newInviteCode() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	for i := range b {
+		b[i] = inviteCodeAlphabet[int(b[i])%len(inviteCodeAlphabet)]
+	}
+	return string(b)
+}
+
+// groupMembership reports whether userID belongs to groupID and is an admin.
+func groupMembership(groupID, userID int64) (member, admin bool, err error) {
+	err = db.QueryRow(
+		"SELECT is_admin FROM group_members WHERE group_id = ? AND user_id = ?",
+		groupID, userID,
+	).Scan(&admin)
+	if err == sql.ErrNoRows {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	return true, admin, nil
+}
+
+func groupMemberIDs(groupID int64) (map[int64]bool, error) {
+	rows, err := db.Query("SELECT user_id FROM group_members WHERE group_id = ?", groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := map[int64]bool{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+	return ids, rows.Err()
+}
+
+// filterLeaderboard keeps only the given players and re-ranks them. Scores
+// are left as computed for the full board, so a group ranks its members by
+// the same Bayesian weighting as the global leaderboard.
+func filterLeaderboard(entries []LeaderboardEntry, keep map[int64]bool) []LeaderboardEntry {
+	out := []LeaderboardEntry{}
+	for _, e := range entries {
+		if keep[e.UserID] {
+			e.Rank = len(out) + 1
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// groupFromPath resolves the {id} path value and checks the caller is a
+// member, writing an error response and returning ok=false if not.
+func groupFromPath(w http.ResponseWriter, r *http.Request, user *User) (groupID int64, admin bool, ok bool) {
+	groupID, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid group id", http.StatusBadRequest)
+		return 0, false, false
+	}
+	member, admin, err := groupMembership(groupID, user.ID)
+	if err != nil {
+		http.Error(w, "Failed to load group", http.StatusInternalServerError)
+		return 0, false, false
+	}
+	if !member {
+		http.Error(w, "Group not found", http.StatusNotFound)
+		return 0, false, false
+	}
+	return groupID, admin, true
+}
+
+func handleCreateGroup(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromRequest(r)
+	if user == nil {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+	if user.Banned {
+		http.Error(w, "Account is banned", http.StatusForbidden)
+		return
+	}
+
+	var body struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	name := sanitizeName(body.Name)
+	nameLen := utf8.RuneCountInString(name)
+	if nameLen < 1 || nameLen > 30 {
+		http.Error(w, "Group name must be 1-30 characters", http.StatusBadRequest)
+		return
+	}
+	if !validNamePattern.MatchString(name) {
+		http.Error(w, "Group name can only contain letters, numbers, spaces, hyphens, and underscores", http.StatusBadRequest)
+		return
+	}
+	if isProfane, err := checkProfanity(name); err == nil && isProfane {
+		http.Error(w, "That name is not allowed", http.StatusBadRequest)
+		return
+	}
+
+	var count int
+	db.QueryRow("SELECT COUNT(*) FROM group_members WHERE user_id = ?", user.ID).Scan(&count)
+	if count >= maxGroupsPerUser {
+		http.Error(w, "You are in too many groups", http.StatusConflict)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		http.Error(w, "Failed to create group", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	code := newInviteCode()
+	var groupID int64
+	err = tx.QueryRow(
+		"INSERT INTO player_groups (name, invite_code, created_by) VALUES (?, ?, ?) RETURNING id",
+		name, code, user.ID,
+	).Scan(&groupID)
+	if err == nil {
+		_, err = tx.Exec(
+			"INSERT INTO group_members (group_id, user_id, is_admin) VALUES (?, ?, TRUE)",
+			groupID, user.ID,
+		)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("POST /api/groups: db error: %v", err)
+		http.Error(w, "Failed to create group", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Group{ID: groupID, Name: name, InviteCode: code, MemberCount: 1, IsAdmin: true})
+}
+
+func handleListGroups(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromRequest(r)
+	if user == nil {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT g.id, g.name, g.invite_code, m.is_admin,
+			(SELECT COUNT(*) FROM group_members WHERE group_id = g.id)
+		FROM player_groups g
+		JOIN group_members m ON m.group_id = g.id
+		WHERE m.user_id = ?
+		ORDER BY g.name
+	`, user.ID)
+	if err != nil {
+		http.Error(w, "Failed to query groups", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	groups := []Group{}
+	for rows.Next() {
+		var g Group
+		if err := rows.Scan(&g.ID, &g.Name, &g.InviteCode, &g.IsAdmin, &g.MemberCount); err != nil {
+			continue
+		}
+		groups = append(groups, g)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"groups": groups})
+}
+
+func handleJoinGroup(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromRequest(r)
+	if user == nil {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+	if user.Banned {
+		http.Error(w, "Account is banned", http.StatusForbidden)
+		return
+	}
+
+	var body struct {
+		InviteCode string `json:"invite_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var g Group
+	err := db.QueryRow(
+		"SELECT id, name, invite_code FROM player_groups WHERE invite_code = ?",
+		strings.ToUpper(strings.TrimSpace(body.InviteCode)),
+	).Scan(&g.ID, &g.Name, &g.InviteCode)
+	if err != nil {
+		http.Error(w, "Invalid invite code", http.StatusNotFound)
+		return
+	}
+
+	var groupCount int
+	db.QueryRow("SELECT COUNT(*) FROM group_members WHERE user_id = ?", user.ID).Scan(&groupCount)
+	if groupCount >= maxGroupsPerUser {
+		http.Error(w, "You are in too many groups", http.StatusConflict)
+		return
+	}
+	db.QueryRow("SELECT COUNT(*) FROM group_members WHERE group_id = ?", g.ID).Scan(&g.MemberCount)
+	if g.MemberCount >= maxGroupMembers {
+		http.Error(w, "Group is full", http.StatusConflict)
+		return
+	}
+
+	result, err := db.Exec(
+		"INSERT INTO group_members (group_id, user_id) VALUES (?, ?) ON CONFLICT(group_id, user_id) DO NOTHING",
+		g.ID, user.ID,
+	)
+	if err != nil {
+		log.Printf("POST /api/groups/join: db error: %v", err)
+		http.Error(w, "Failed to join group", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		g.MemberCount++
+	}
+	_, g.IsAdmin, _ = groupMembership(g.ID, user.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(g)
+}
+
+func handleGetGroup(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromRequest(r)
+	if user == nil {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+	groupID, admin, ok := groupFromPath(w, r, user)
+	if !ok {
+		return
+	}
+
+	g := Group{ID: groupID, IsAdmin: admin}
+	if err := db.QueryRow("SELECT name, invite_code FROM player_groups WHERE id = ?", groupID).Scan(&g.Name, &g.InviteCode); err != nil {
+		http.Error(w, "Failed to load group", http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := db.Query(`
+		SELECT u.id, COALESCE(u.custom_name, u.display_name), COALESCE(u.avatar_url, ''), m.is_admin, m.joined_at
+		FROM group_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.group_id = ?
+		ORDER BY m.joined_at, u.id
+	`, groupID)
+	if err != nil {
+		http.Error(w, "Failed to load group", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	members := []GroupMember{}
+	for rows.Next() {
+		var m GroupMember
+		if err := rows.Scan(&m.UserID, &m.DisplayName, &m.AvatarURL, &m.IsAdmin, &m.JoinedAt); err != nil {
+			continue
+		}
+		members = append(members, m)
+	}
+	g.MemberCount = len(members)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"group": g, "members": members})
+}
+
+// removeGroupMember deletes a membership. If that leaves the group without
+// an admin, its longest-standing member is promoted; if it leaves the group
+// empty, the group is deleted.
+func removeGroupMember(groupID, userID int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := leaveGroup(tx, groupID, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// leaveGroup does removeGroupMember's work in the caller's transaction.
+func leaveGroup(q querier, groupID, userID int64) error {
+	if _, err := q.Exec("DELETE FROM group_members WHERE group_id = ? AND user_id = ?", groupID, userID); err != nil {
+		return err
+	}
+
+	var members, admins int
+	err := q.QueryRow(
+		"SELECT COUNT(*), COALESCE(SUM(CASE WHEN is_admin THEN 1 ELSE 0 END), 0) FROM group_members WHERE group_id = ?",
+		groupID,
+	).Scan(&members, &admins)
+	if err != nil {
+		return err
+	}
+
+	if members == 0 {
+		_, err = q.Exec("DELETE FROM player_groups WHERE id = ?", groupID)
+	} else if admins == 0 {
+		_, err = q.Exec(`
+			UPDATE group_members SET is_admin = TRUE
+			WHERE group_id = ? AND user_id = (
+				SELECT user_id FROM group_members WHERE group_id = ? ORDER BY joined_at, user_id LIMIT 1
+			)
+		`, groupID, groupID)
+	}
+	return err
+}
+
+// userGroupIDs lists the groups a player belongs to.
+func userGroupIDs(q querier, userID int64) ([]int64, error) {
+	rows, err := q.Query("SELECT group_id FROM group_members WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func handleLeaveGroup(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromRequest(r)
+	if user == nil {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+	groupID, _, ok := groupFromPath(w, r, user)
+	if !ok {
+		return
+	}
+
+	if err := removeGroupMember(groupID, user.ID); err != nil {
+		log.Printf("POST /api/groups/%d/leave: db error: %v", groupID, err)
+		http.Error(w, "Failed to leave group", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"ok":true}`))
+}
+
+// handleRemoveGroupMember lets a group admin remove another member.
+func handleRemoveGroupMember(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromRequest(r)
+	if user == nil {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+	groupID, admin, ok := groupFromPath(w, r, user)
+	if !ok {
+		return
+	}
+	if !admin {
+		http.Error(w, "Only group admins can remove members", http.StatusForbidden)
+		return
+	}
+
+	var body struct {
+		UserID int64 `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if body.UserID == user.ID {
+		http.Error(w, "Use leave to remove yourself", http.StatusBadRequest)
+		return
+	}
+	if member, _, err := groupMembership(groupID, body.UserID); err != nil || !member {
+		http.Error(w, "User is not a member of this group", http.StatusNotFound)
+		return
+	}
+
+	if err := removeGroupMember(groupID, body.UserID); err != nil {
+		log.Printf("POST /api/groups/%d/remove: db error: %v", groupID, err)
+		http.Error(w, "Failed to remove member", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Group %d: admin %d removed user %d", groupID, user.ID, body.UserID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"ok":true}`))
+}
+
+// handleGetGroupLeaderboard ranks a group's members. It accepts the same
+// window parameters as /api/leaderboard.
+func handleGetGroupLeaderboard(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromRequest(r)
+	if user == nil {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+	groupID, _, ok := groupFromPath(w, r, user)
+	if !ok {
+		return
+	}
+
+	win, err := parseLeaderboardWindow(r, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entries, err := getLeaderboard(win)
+	if err != nil {
+		log.Printf("GET /api/groups/%d/leaderboard: %v", groupID, err)
+		http.Error(w, "Failed to query leaderboard", http.StatusInternalServerError)
+		return
+	}
+	members, err := groupMemberIDs(groupID)
+	if err != nil {
+		http.Error(w, "Failed to query leaderboard", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"leaderboard": filterLeaderboard(entries, members),
+		"period":      win.Period,
+		"from":        win.From,
+		"to":          win.To,
+	})
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// handleListIdentities lists the sign-in methods linked to the caller's
+// account. Linking a new one goes through GET /auth/{provider}?link=1.
+func handleListIdentities(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromRequest(r)
+	if user == nil {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	identities, err := store.ListIdentities(user.ID)
+	if err != nil {
+		log.Printf("GET /api/me/identities: user %d: %v", user.ID, err)
+		http.Error(w, "Failed to load identities", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"identities": identities})
+}
+
+// handleUnlinkIdentity removes one of the caller's sign-in methods, as long
+// as another remains.
+func handleUnlinkIdentity(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromRequest(r)
+	if user == nil {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	var body struct {
+		Provider string `json:"provider"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Provider == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	err := store.UnlinkIdentity(user.ID, body.Provider)
+	if err == errLastIdentity {
+		http.Error(w, "Can't unlink your only sign-in method", http.StatusConflict)
+		return
+	}
+	if err == sql.ErrNoRows {
+		http.Error(w, "No "+body.Provider+" account is linked", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("POST /api/me/identities/unlink: user %d: %v", user.ID, err)
+		http.Error(w, "Failed to unlink account", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("User %d unlinked %s", user.ID, body.Provider)
+	audit(r, user.ID, "identity.unlink", user.ID, map[string]interface{}{"provider": body.Provider}, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"ok":true}`))
+}
+
+// handleAdminMerge folds one account into another, for players who signed up
+// twice before they could link providers.
+func handleAdminMerge(w http.ResponseWriter, r *http.Request) {
+	admin := getUserFromRequest(r)
+
+	var body struct {
+		KeepUserID  int64 `json:"keep_user_id"`
+		MergeUserID int64 `json:"merge_user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if body.KeepUserID == body.MergeUserID {
+		http.Error(w, "Can't merge an account into itself", http.StatusBadRequest)
+		return
+	}
+	if _, err := store.GetUser(body.KeepUserID); err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	merged, err := store.GetUser(body.MergeUserID)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	err = mergeUsers(body.KeepUserID, body.MergeUserID)
+	var conflict mergeConflict
+	if errors.As(err, &conflict) {
+		http.Error(w, conflict.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("POST /api/admin/merge: %v", err)
+		http.Error(w, "Failed to merge accounts", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Admin %d merged user %d into %d", admin.ID, body.MergeUserID, body.KeepUserID)
+	audit(r, admin.ID, "account.merge", body.KeepUserID, map[string]interface{}{
+		"merge_user_id": body.MergeUserID,
+		"provider":      merged.Provider,
+		"display_name":  merged.DisplayName,
+	}, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"ok":true}`))
+}
+
+// mergeConflict is returned when both accounts have a sign-in from the same
+// provider, since a user can only link one per provider.
+type mergeConflict string
+
+func (p mergeConflict) Error() string {
+	return fmt.Sprintf("both accounts have a %s sign-in; one must be unlinked first", string(p))
+}
+
+// mergeUsers moves everything belonging to mergeID onto keepID and then
+// anonymises mergeID like a deleted account. Where both played the same day,
+// keepID's game wins. Stats are rebuilt from the combined results.
+func mergeUsers(keepID, mergeID int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var provider string
+	err = tx.QueryRow(`
+		SELECT provider FROM identities
+		WHERE user_id = ? AND provider IN (SELECT provider FROM identities WHERE user_id = ?)
+		LIMIT 1
+	`, mergeID, keepID).Scan(&provider)
+	if err == nil {
+		return mergeConflict(provider)
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	stmts := []string{
+		"UPDATE identities SET user_id = :keep WHERE user_id = :merge",
+		"DELETE FROM sessions WHERE user_id = :merge",
+
+		"UPDATE game_results SET user_id = :keep WHERE user_id = :merge AND date NOT IN (SELECT date FROM game_results WHERE user_id = :keep)",
+		"DELETE FROM game_results WHERE user_id = :merge",
+		"DELETE FROM leaderboard_daily WHERE user_id = :keep OR user_id = :merge",
+		leaderboardDailySQL + " WHERE user_id = :keep",
+		"UPDATE game_progress SET user_id = :keep WHERE user_id = :merge AND date NOT IN (SELECT date FROM game_progress WHERE user_id = :keep)",
+		"DELETE FROM game_progress WHERE user_id = :merge",
+		"DELETE FROM user_stats WHERE user_id = :merge",
+		"UPDATE tz_events SET user_id = :keep WHERE user_id = :merge",
+		"UPDATE cheat_flags SET user_id = :keep WHERE user_id = :merge",
+		"UPDATE voided_results SET user_id = :keep WHERE user_id = :merge AND date NOT IN (SELECT date FROM voided_results WHERE user_id = :keep)",
+		"DELETE FROM voided_results WHERE user_id = :merge",
+
+		// A friendship between the two accounts, or with someone keep is
+		// already connected to, is dropped rather than duplicated
+		`DELETE FROM friendships
+			WHERE (requester_id = :merge AND addressee_id = :keep) OR (requester_id = :keep AND addressee_id = :merge)`,
+		`UPDATE friendships SET requester_id = :keep
+			WHERE requester_id = :merge AND NOT EXISTS (
+				SELECT 1 FROM friendships f
+				WHERE (f.requester_id = :keep AND f.addressee_id = friendships.addressee_id)
+				   OR (f.addressee_id = :keep AND f.requester_id = friendships.addressee_id)
+			)`,
+		`UPDATE friendships SET addressee_id = :keep
+			WHERE addressee_id = :merge AND NOT EXISTS (
+				SELECT 1 FROM friendships f
+				WHERE (f.requester_id = :keep AND f.addressee_id = friendships.requester_id)
+				   OR (f.addressee_id = :keep AND f.requester_id = friendships.requester_id)
+			)`,
+		"DELETE FROM friendships WHERE requester_id = :merge OR addressee_id = :merge",
+
+		`UPDATE group_members SET is_admin = TRUE
+			WHERE user_id = :keep AND group_id IN (
+				SELECT group_id FROM group_members WHERE user_id = :merge AND is_admin = TRUE
+			)`,
+		"UPDATE group_members SET user_id = :keep WHERE user_id = :merge AND group_id NOT IN (SELECT group_id FROM group_members WHERE user_id = :keep)",
+		"DELETE FROM group_members WHERE user_id = :merge",
+		"UPDATE player_groups SET created_by = :keep WHERE created_by = :merge",
+
+		`UPDATE users SET
+			provider = 'merged',
+			provider_id = CAST(id AS TEXT),
+			display_name = 'Merged player',
+			custom_name = NULL,
+			avatar_url = NULL,
+			deleted_at = CURRENT_TIMESTAMP
+		WHERE id = :merge`,
+	}
+	for _, stmt := range stmts {
+		// The statements name the two users rather than repeat positional
+		// arguments, which both backends would bind differently
+		query, args := bindUsers(stmt, keepID, mergeID)
+		if _, err := tx.Exec(query, args...); err != nil {
+			return fmt.Errorf("%s: %w", stmt, err)
+		}
+	}
+	if err := refreshUserStats(tx, keepID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	invalidateLeaderboard()
+	return nil
+}
+
+// bindUsers replaces :keep and :merge in a query with ? placeholders and
+// returns the matching arguments.
+func bindUsers(stmt string, keepID, mergeID int64) (string, []interface{}) {
+	var args []interface{}
+	query := []byte{}
+	for i := 0; i < len(stmt); i++ {
+		switch {
+		case stmt[i] == ':' && len(stmt[i:]) >= 5 && stmt[i:i+5] == ":keep":
+			query = append(query, '?')
+			args = append(args, keepID)
+			i += 4
+		case stmt[i] == ':' && len(stmt[i:]) >= 6 && stmt[i:i+6] == ":merge":
+			query = append(query, '?')
+			args = append(args, mergeID)
+			i += 5
+		default:
+			query = append(query, stmt[i])
+		}
+	}
+	return string(query), args
+}
@@ -2,8 +2,12 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
+	"log"
 	"net/http"
 	"strconv"
+	"sync"
+	"time"
 )
 
 type LeaderboardEntry struct {
@@ -28,89 +32,409 @@ func handleGetLeaderboard(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	win, err := parseLeaderboardWindow(r, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	offset := 0
+	if o, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil && o > 0 {
+		offset = o
+	}
+
+	entries, err := getLeaderboard(win)
+	if err != nil {
+		log.Printf("GET /api/leaderboard: %v", err)
+		http.Error(w, "Failed to query leaderboard", http.StatusInternalServerError)
+		return
+	}
+
+	total := len(entries)
+	page := entries[min(offset, total):min(offset+limit, total)]
+	var nextOffset *int
+	if offset+limit < total {
+		next := offset + limit
+		nextOffset = &next
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"leaderboard": page,
+		"total":       total,
+		"offset":      offset,
+		"next_offset": nextOffset,
+		"period":      win.Period,
+		"from":        win.From,
+		"to":          win.To,
+	})
+}
+
+// handleGetMyRank returns the caller's position in a leaderboard window and
+// the entries immediately above and below them.
+func handleGetMyRank(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromRequest(r)
+	if user == nil {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	radius := 2
+	if rs := r.URL.Query().Get("radius"); rs != "" {
+		if n, err := strconv.Atoi(rs); err == nil && n >= 0 && n <= 10 {
+			radius = n
+		}
+	}
+
+	win, err := parseLeaderboardWindow(r, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entries, err := getLeaderboard(win)
+	if err != nil {
+		log.Printf("GET /api/leaderboard/me: %v", err)
+		http.Error(w, "Failed to query leaderboard", http.StatusInternalServerError)
+		return
+	}
+
+	resp := map[string]interface{}{
+		"rank":   nil,
+		"total":  len(entries),
+		"nearby": []LeaderboardEntry{},
+		"period": win.Period,
+		"from":   win.From,
+		"to":     win.To,
+	}
+	for i, e := range entries {
+		if e.UserID == user.ID {
+			resp["rank"] = e.Rank
+			resp["nearby"] = entries[max(i-radius, 0):min(i+radius+1, len(entries))]
+			break
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// leaderboardWindow limits a leaderboard to results dated From..To inclusive.
+// Empty bounds are open-ended.
+type leaderboardWindow struct {
+	Period string
+	From   string
+	To     string
+}
+
+// parseLeaderboardWindow reads ?period=day|week|month|all (relative to ?date=,
+// default today UTC) or an explicit ?from=&to= range.
+func parseLeaderboardWindow(r *http.Request, now time.Time) (leaderboardWindow, error) {
+	q := r.URL.Query()
+
+	if from, to := q.Get("from"), q.Get("to"); from != "" || to != "" {
+		for _, d := range []string{from, to} {
+			if _, err := time.Parse(dateLayout, d); d != "" && err != nil {
+				return leaderboardWindow{}, fmt.Errorf("invalid date %q", d)
+			}
+		}
+		if from != "" && to != "" && from > to {
+			return leaderboardWindow{}, fmt.Errorf("from must not be after to")
+		}
+		return leaderboardWindow{Period: "range", From: from, To: to}, nil
+	}
+
+	ref := now.UTC()
+	if date := q.Get("date"); date != "" {
+		d, err := time.Parse(dateLayout, date)
+		if err != nil {
+			return leaderboardWindow{}, fmt.Errorf("invalid date %q", date)
+		}
+		ref = d
+	}
+	ref = time.Date(ref.Year(), ref.Month(), ref.Day(), 0, 0, 0, 0, time.UTC)
+
+	switch period := q.Get("period"); period {
+	case "", "all":
+		return leaderboardWindow{Period: "all"}, nil
+	case "day":
+		d := ref.Format(dateLayout)
+		return leaderboardWindow{Period: period, From: d, To: d}, nil
+	case "week":
+		// Weeks run Monday to Sunday
+		start := ref.AddDate(0, 0, -((int(ref.Weekday()) + 6) % 7))
+		return leaderboardWindow{Period: period, From: start.Format(dateLayout), To: start.AddDate(0, 0, 6).Format(dateLayout)}, nil
+	case "month":
+		start := ref.AddDate(0, 0, 1-ref.Day())
+		return leaderboardWindow{Period: period, From: start.Format(dateLayout), To: start.AddDate(0, 1, -1).Format(dateLayout)}, nil
+	default:
+		return leaderboardWindow{}, fmt.Errorf("period must be day, week, month or all")
+	}
+}
+
+// Leaderboards are served from in-memory snapshots of the full ranking, one
+// per window. A snapshot is rebuilt once it is leaderboardMaxAge old, so new
+// results show up within that time (and streaks move at midnight without any
+// write). Bans, name changes and deletions mark every snapshot stale, so the
+// next request rebuilds it. Only one build per window runs at a time: while
+// it does, other requests keep getting the old snapshot, or wait for the
+// build if there isn't one yet.
+const (
+	leaderboardMaxAge    = 60 * time.Second
+	leaderboardCacheSize = 64
+)
+
+type leaderboardSnapshot struct {
+	entries []LeaderboardEntry
+	builtAt time.Time
+	stale   bool
+	// building is the build in progress, if any
+	building *leaderboardBuild
+}
+
+type leaderboardBuild struct {
+	done    chan struct{}
+	entries []LeaderboardEntry
+	err     error
+}
+
+var (
+	leaderboardMu    sync.Mutex
+	leaderboardCache = make(map[leaderboardWindow]*leaderboardSnapshot)
+	// leaderboardGen counts invalidations, so a build that started before one
+	// leaves its snapshot stale.
+	leaderboardGen int
+)
+
+// getLeaderboard returns the full ranking for a window. Callers must not
+// modify it.
+func getLeaderboard(win leaderboardWindow) ([]LeaderboardEntry, error) {
+	leaderboardMu.Lock()
+	snap := leaderboardCache[win]
+	if snap == nil {
+		evictLeaderboardSnapshots()
+		snap = &leaderboardSnapshot{}
+		leaderboardCache[win] = snap
+	}
+	if snap.entries != nil && !snap.stale && time.Since(snap.builtAt) < leaderboardMaxAge {
+		leaderboardMu.Unlock()
+		return snap.entries, nil
+	}
+	if b := snap.building; b != nil {
+		if snap.entries != nil {
+			leaderboardMu.Unlock()
+			return snap.entries, nil
+		}
+		leaderboardMu.Unlock()
+		<-b.done
+		return b.entries, b.err
+	}
+	b := &leaderboardBuild{done: make(chan struct{})}
+	snap.building = b
+	gen := leaderboardGen
+	leaderboardMu.Unlock()
+
+	b.entries, b.err = buildLeaderboard(win)
+
+	leaderboardMu.Lock()
+	snap.building = nil
+	if b.err == nil {
+		snap.entries = b.entries
+		snap.builtAt = time.Now()
+		snap.stale = gen != leaderboardGen
+	}
+	leaderboardMu.Unlock()
+	close(b.done)
+	return b.entries, b.err
+}
+
+// evictLeaderboardSnapshots makes room for another window. Explicit ranges
+// are unbounded, so they mustn't pile up. Snapshots being built are kept so
+// their waiters still share the one build.
+func evictLeaderboardSnapshots() {
+	if len(leaderboardCache) < leaderboardCacheSize {
+		return
+	}
+	for win, snap := range leaderboardCache {
+		if snap.building == nil {
+			delete(leaderboardCache, win)
+		}
+	}
+}
+
+// invalidateLeaderboard marks every snapshot stale, so the next request for
+// any window rebuilds it.
+func invalidateLeaderboard() {
+	leaderboardMu.Lock()
+	for _, snap := range leaderboardCache {
+		snap.stale = true
+	}
+	leaderboardGen++
+	leaderboardMu.Unlock()
+}
+
+// leaderboardDailySQL copies game_results rows into leaderboard_daily, the
+// per-player, per-date totals leaderboards are built from. Callers add a
+// WHERE clause on user_id and date. A game's score is its guesses, with hard
+// mode wins getting a 10% bonus (guesses * 0.9) and losses counting as 8.
+// Scores are kept in tenths so they sum exactly.
+const leaderboardDailySQL = `
+	INSERT INTO leaderboard_daily (date, user_id, games, wins, hard_wins, score_tenths, guess_sum)
+	SELECT
+		date,
+		user_id,
+		1,
+		CASE WHEN won THEN 1 ELSE 0 END,
+		CASE WHEN won AND hard_mode THEN 1 ELSE 0 END,
+		CASE
+			WHEN won AND hard_mode THEN guesses * 9
+			WHEN won THEN guesses * 10
+			ELSE 80
+		END,
+		CASE WHEN won THEN guesses ELSE 8 END
+	FROM game_results`
+
+// buildLeaderboard ranks every player with results in the window, in three
+// queries: the totals from leaderboard_daily, the streaks stored in
+// user_stats, and each player's last timezone offset. The global mean is
+// taken over the same window, so a short window isn't dragged toward the
+// all-time average. Streaks are always the player's current streak.
+func buildLeaderboard(win leaderboardWindow) ([]LeaderboardEntry, error) {
+	from, to := win.From, win.To
+	if to == "" {
+		to = "9999-12-31"
+	}
+
 	// Bayesian weighted average: pulls players with few games toward the global mean.
 	// Formula: bayesian_avg = (C * global_mean + player_sum) / (C + games_played)
 	// C = 10 (confidence parameter). Higher C = more games needed to diverge from mean.
-	// Hard mode wins get 10% bonus (guesses * 0.9). Losses count as 7.
-	// Streak computed in Go since SQL window-based streak is complex in SQLite.
 	rows, err := db.Query(`
-		WITH global AS (
-			SELECT SUM(
-				CASE
-					WHEN gr.won AND gr.hard_mode THEN gr.guesses * 0.9
-					WHEN gr.won THEN gr.guesses
-					ELSE 8.0
-				END
-			) / COUNT(*) AS mean
-			FROM game_results gr
-			JOIN users u ON u.id = gr.user_id
-			WHERE u.banned = FALSE
-		),
-		player AS (
+		WITH player AS (
 			SELECT
-				u.id AS user_id,
-				COALESCE(u.custom_name, u.display_name) AS display_name,
-				COALESCE(u.avatar_url, '') AS avatar_url,
-				SUM(
-					CASE
-						WHEN gr.won AND gr.hard_mode THEN gr.guesses * 0.9
-						WHEN gr.won THEN gr.guesses
-						ELSE 8.0
-					END
-				) AS score_sum,
-				CAST(SUM(CASE WHEN gr.won THEN gr.guesses ELSE 8 END) AS REAL) / COUNT(*) AS true_avg,
-				CAST(SUM(CASE WHEN gr.won THEN 1 ELSE 0 END) AS REAL) / COUNT(*) AS win_rate,
-				COUNT(*) AS games_played,
-				SUM(CASE WHEN gr.won AND gr.hard_mode THEN 1 ELSE 0 END) AS hard_mode_wins
-			FROM users u
-			JOIN game_results gr ON gr.user_id = u.id
-			WHERE u.banned = FALSE
-			GROUP BY u.id
-			HAVING COUNT(*) >= 1
+				d.user_id,
+				SUM(d.score_tenths) / 10.0 AS score_sum,
+				SUM(d.guess_sum) AS guess_sum,
+				SUM(d.games) AS games_played,
+				SUM(d.wins) AS wins,
+				SUM(d.hard_wins) AS hard_mode_wins
+			FROM leaderboard_daily d
+			JOIN users u ON u.id = d.user_id
+			WHERE u.banned = FALSE AND d.date >= ? AND d.date <= ?
+			GROUP BY d.user_id
+		),
+		global AS (
+			SELECT SUM(score_sum) / SUM(games_played) AS mean FROM player
 		)
 		SELECT
 			p.user_id,
-			p.display_name,
-			p.avatar_url,
+			COALESCE(u.custom_name, u.display_name),
+			COALESCE(u.avatar_url, ''),
 			(10.0 * g.mean + p.score_sum) / (10.0 + p.games_played) AS weighted_avg,
-			p.true_avg,
-			p.win_rate,
+			CAST(p.guess_sum AS REAL) / p.games_played,
+			CAST(p.wins AS REAL) / p.games_played AS win_rate,
 			p.games_played,
 			p.hard_mode_wins
-		FROM player p, global g
-		ORDER BY weighted_avg ASC, win_rate DESC, games_played DESC
-		LIMIT ?
-	`, limit)
+		FROM player p
+		JOIN users u ON u.id = p.user_id, global g
+		ORDER BY weighted_avg ASC, win_rate DESC, p.games_played DESC, p.user_id ASC
+	`, from, to)
 	if err != nil {
-		http.Error(w, "Failed to query leaderboard", http.StatusInternalServerError)
-		return
+		return nil, err
 	}
 	defer rows.Close()
 
-	var entries []LeaderboardEntry
+	entries := []LeaderboardEntry{}
 	rank := 1
 	for rows.Next() {
 		var e LeaderboardEntry
 		err := rows.Scan(&e.UserID, &e.DisplayName, &e.AvatarURL, &e.WeightedAvg, &e.TrueAvg, &e.WinRate, &e.GamesPlayed, &e.HardModeWins)
 		if err != nil {
-			continue
+			return nil, err
 		}
 		e.Rank = rank
 		rank++
 		entries = append(entries, e)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-	// Compute current streak for each player
+	streaks, err := allCurrentStreaks(time.Now())
+	if err != nil {
+		return nil, err
+	}
 	for i := range entries {
-		entries[i].Streak = computeStreak(entries[i].UserID)
+		entries[i].Streak = streaks[entries[i].UserID]
+	}
+
+	return entries, nil
+}
+
+// DailyResultEntry is one player's result on the daily results board.
+type DailyResultEntry struct {
+	Rank        int    `json:"rank"`
+	UserID      int64  `json:"user_id"`
+	DisplayName string `json:"display_name"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+	Won         bool   `json:"won"`
+	Guesses     *int   `json:"guesses"`
+	HardMode    bool   `json:"hard_mode"`
+	SubmittedAt string `json:"submitted_at"`
+}
+
+// handleGetDailyResults ranks a single day's results: winners first by fewest
+// guesses, ties broken by who finished first.
+func handleGetDailyResults(w http.ResponseWriter, r *http.Request) {
+	date := r.URL.Query().Get("date")
+	if date == "" {
+		date = time.Now().UTC().Format(dateLayout)
+	}
+	if _, err := time.Parse(dateLayout, date); err != nil {
+		http.Error(w, "Invalid date", http.StatusBadRequest)
+		return
+	}
+
+	limitStr := r.URL.Query().Get("limit")
+	limit := 50
+	if limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 100 {
+			limit = l
+		}
+	}
+
+	rows, err := db.Query(`
+		SELECT
+			u.id,
+			COALESCE(u.custom_name, u.display_name),
+			COALESCE(u.avatar_url, ''),
+			gr.won,
+			gr.guesses,
+			gr.hard_mode,
+			gr.created_at
+		FROM game_results gr
+		JOIN users u ON u.id = gr.user_id
+		WHERE u.banned = FALSE AND gr.date = ?
+		ORDER BY gr.won DESC, gr.guesses ASC, gr.created_at ASC, gr.id ASC
+		LIMIT ?
+	`, date, limit)
+	if err != nil {
+		http.Error(w, "Failed to query results", http.StatusInternalServerError)
+		return
 	}
+	defer rows.Close()
 
-	if entries == nil {
-		entries = []LeaderboardEntry{}
+	entries := []DailyResultEntry{}
+	for rows.Next() {
+		var e DailyResultEntry
+		if err := rows.Scan(&e.UserID, &e.DisplayName, &e.AvatarURL, &e.Won, &e.Guesses, &e.HardMode, &e.SubmittedAt); err != nil {
+			continue
+		}
+		e.Rank = len(entries) + 1
+		entries = append(entries, e)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]interface{}{"leaderboard": entries})
+	json.NewEncoder(w).Encode(map[string]interface{}{"date": date, "results": entries})
 }
 
 func handleSubmitResult(w http.ResponseWriter, r *http.Request) {
@@ -137,6 +461,12 @@ func handleSubmitResult(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Date is required", http.StatusBadRequest)
 		return
 	}
+	puzzle, err := currentPuzzle(body.Date)
+	if err != nil {
+		log.Printf("POST /api/result: user %d: %v", user.ID, err)
+		http.Error(w, "Invalid puzzle date", http.StatusBadRequest)
+		return
+	}
 
 	// Validate guesses
 	if body.Won && (body.Guesses == nil || *body.Guesses < 1 || *body.Guesses > 6) {
@@ -144,7 +474,37 @@ func handleSubmitResult(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := insertGameResult(user.ID, body.Date, body.Won, body.Guesses, body.HardMode); err != nil {
+	// The result is derived by replaying the saved guesses; the client's
+	// claim only has to agree with it.
+	progress, err := store.GetProgress(user.ID, body.Date)
+	if err != nil {
+		http.Error(w, "No saved game for this date", http.StatusConflict)
+		return
+	}
+	guesses, err := validateGuesses(progress.Guesses)
+	if err != nil {
+		log.Printf("POST /api/result: user %d: rejected game: %v", user.ID, err)
+		http.Error(w, "Invalid game", http.StatusBadRequest)
+		return
+	}
+	outcome, err := replayGame(puzzle, guesses)
+	if err != nil {
+		log.Printf("POST /api/result: user %d: rejected game: %v", user.ID, err)
+		http.Error(w, "Invalid game", http.StatusBadRequest)
+		return
+	}
+	if !outcome.GameOver {
+		http.Error(w, "Game is not over", http.StatusConflict)
+		return
+	}
+
+	if mismatch := resultMismatch(body.Won, body.Guesses, body.HardMode, outcome); mismatch != "" {
+		flagGame(user.ID, body.Date, "result", mismatch)
+		http.Error(w, "Result does not match saved game", http.StatusConflict)
+		return
+	}
+
+	if err := recordOutcome(user.ID, body.Date, outcome, body.HardMode); err != nil {
 		http.Error(w, "Failed to save result", http.StatusInternalServerError)
 		return
 	}
@@ -164,25 +524,17 @@ func handleSubmitResult(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(resp)
 }
 
-func computeStreak(userID int64) int {
-	rows, err := db.Query(`
-		SELECT won FROM game_results
-		WHERE user_id = ?
-		ORDER BY date DESC
-	`, userID)
-	if err != nil {
-		return 0
+// resultMismatch describes how a client's claimed result differs from the
+// replayed outcome, or returns "" if they agree.
+func resultMismatch(won bool, guesses *int, hardMode bool, o *GameOutcome) string {
+	if won != o.Won {
+		return fmt.Sprintf("claimed won=%v, replay won=%v", won, o.Won)
 	}
-	defer rows.Close()
-
-	streak := 0
-	for rows.Next() {
-		var won bool
-		rows.Scan(&won)
-		if !won {
-			break
-		}
-		streak++
+	if won && *guesses != o.Guesses {
+		return fmt.Sprintf("claimed %d guesses, replay has %d", *guesses, o.Guesses)
+	}
+	if hardMode && !o.HardModeValid {
+		return "claimed hard mode but guesses break hard-mode rules"
 	}
-	return streak
+	return ""
 }
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// TestLeaderboardSnapshot checks that a recorded result waits for the
+// snapshot to expire while a ban shows up at once.
+func TestLeaderboardSnapshot(t *testing.T) {
+	useTestDB(t)
+
+	if _, err := db.Exec("INSERT INTO users (id, provider, provider_id, display_name) VALUES (1, 'github', '1', 'One'), (2, 'github', '2', 'Two')"); err != nil {
+		t.Fatal(err)
+	}
+	three := 3
+	if err := insertGameResult(1, "2024-01-01", true, &three, false); err != nil {
+		t.Fatal(err)
+	}
+
+	win := leaderboardWindow{Period: "all"}
+	count := func() int {
+		t.Helper()
+		entries, err := getLeaderboard(win)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(entries)
+	}
+
+	if got := count(); got != 1 {
+		t.Fatalf("got %d entries, want 1", got)
+	}
+	if err := insertGameResult(2, "2024-01-01", true, &three, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := count(); got != 1 {
+		t.Errorf("after a new result got %d entries, want the snapshot's 1", got)
+	}
+
+	leaderboardMu.Lock()
+	leaderboardCache[win].builtAt = time.Now().Add(-leaderboardMaxAge)
+	leaderboardMu.Unlock()
+	if got := count(); got != 2 {
+		t.Errorf("after the snapshot expired got %d entries, want 2", got)
+	}
+
+	if err := banUser(2); err != nil {
+		t.Fatal(err)
+	}
+	if got := count(); got != 1 {
+		t.Errorf("after a ban got %d entries, want 1", got)
+	}
+}
+
+// TestLeaderboardSingleBuild checks that requests arriving while a window is
+// being built share that build: they get the old snapshot if there is one,
+// or wait for the build on a cold cache.
+func TestLeaderboardSingleBuild(t *testing.T) {
+	useTestDB(t)
+	win := leaderboardWindow{Period: "all"}
+	old := []LeaderboardEntry{{Rank: 1, UserID: 1}}
+	built := []LeaderboardEntry{{Rank: 1, UserID: 1}, {Rank: 2, UserID: 2}}
+
+	// A stale snapshot is served while it is rebuilt
+	b := &leaderboardBuild{done: make(chan struct{})}
+	leaderboardMu.Lock()
+	leaderboardCache[win] = &leaderboardSnapshot{entries: old, builtAt: time.Now(), stale: true, building: b}
+	leaderboardMu.Unlock()
+	if entries, err := getLeaderboard(win); err != nil || len(entries) != 1 {
+		t.Errorf("during a rebuild got %d entries, %v, want the old snapshot's 1", len(entries), err)
+	}
+
+	// With nothing to serve, callers wait for the build in progress
+	b = &leaderboardBuild{done: make(chan struct{})}
+	leaderboardMu.Lock()
+	leaderboardCache[win] = &leaderboardSnapshot{building: b}
+	leaderboardMu.Unlock()
+	got := make(chan int)
+	for i := 0; i < 3; i++ {
+		go func() {
+			entries, _ := getLeaderboard(win)
+			got <- len(entries)
+		}()
+	}
+	select {
+	case n := <-got:
+		t.Fatalf("returned %d entries before the build finished", n)
+	case <-time.After(50 * time.Millisecond):
+	}
+	b.entries = built
+	close(b.done)
+	for i := 0; i < 3; i++ {
+		if n := <-got; n != 2 {
+			t.Errorf("waiter got %d entries, want the build's 2", n)
+		}
+	}
+}
+
+// TestLeaderboardStreak checks that the leaderboard shows the streak stored
+// with a player's stats while it is still alive.
+func TestLeaderboardStreak(t *testing.T) {
+	useTestDB(t)
+	if _, err := db.Exec("INSERT INTO users (id, provider, provider_id, display_name) VALUES (1, 'github', '1', 'One')"); err != nil {
+		t.Fatal(err)
+	}
+	today, _ := time.Parse(dateLayout, playerToday(db, 1, time.Now()))
+	three := 3
+	for _, d := range []time.Time{today.AddDate(0, 0, -3), today.AddDate(0, 0, -1), today} {
+		if err := insertGameResult(1, d.Format(dateLayout), true, &three, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := buildLeaderboard(leaderboardWindow{Period: "all"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Streak != 2 || entries[0].GamesPlayed != 3 || entries[0].TrueAvg != 3 {
+		t.Errorf("leaderboard = %+v, want one player on a streak of 2", entries)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"net/http"
 	"os"
@@ -8,28 +9,82 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		runCommand(os.Args[1:])
+		return
+	}
+
 	if err := initDB(); err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
+	if err := loadSigningKeys(); err != nil {
+		log.Fatalf("Failed to load signing keys: %v", err)
+	}
+	if err := grantBootstrapAdmins(); err != nil {
+		log.Fatalf("Failed to grant bootstrap admins: %v", err)
+	}
+
+	startBackupSchedule()
 
 	mux := http.NewServeMux()
 
 	// Auth routes
 	mux.HandleFunc("GET /auth/{provider}", handleAuthStart)
 	mux.HandleFunc("GET /auth/{provider}/callback", handleAuthCallback)
+	mux.HandleFunc("GET /auth/providers", handleAuthProviders)
 	mux.HandleFunc("GET /auth/me", handleAuthMe)
 	mux.HandleFunc("POST /auth/logout", handleAuthLogout)
 
 	// API routes
 	mux.HandleFunc("POST /api/result", handleSubmitResult)
 	mux.HandleFunc("GET /api/leaderboard", handleGetLeaderboard)
+	mux.HandleFunc("GET /api/leaderboard/daily", handleGetDailyResults)
+	mux.HandleFunc("GET /api/leaderboard/me", handleGetMyRank)
+	mux.HandleFunc("GET /api/puzzle", handleGetPuzzle)
 	mux.HandleFunc("GET /api/game-state", handleGetGameState)
 	mux.HandleFunc("POST /api/save-progress", handleSaveProgress)
+	mux.HandleFunc("POST /api/guess", handleGuess)
 	mux.HandleFunc("GET /api/user-stats", handleGetUserStats)
 	mux.HandleFunc("POST /api/user-stats", handleSaveUserStats)
 	mux.HandleFunc("POST /api/display-name", handleUpdateDisplayName)
-	mux.HandleFunc("POST /api/admin/ban", handleBanUser)
-	mux.HandleFunc("GET /api/admin/users", handleListUsers)
+	mux.HandleFunc("GET /api/me/export", handleExportMe)
+	mux.HandleFunc("DELETE /api/me", handleDeleteMe)
+	mux.HandleFunc("GET /api/me/identities", handleListIdentities)
+	mux.HandleFunc("POST /api/me/identities/unlink", handleUnlinkIdentity)
+	mux.HandleFunc("GET /api/me/sessions", handleListSessions)
+	mux.HandleFunc("DELETE /api/me/sessions", handleRevokeAllSessions)
+	mux.HandleFunc("DELETE /api/me/sessions/{id}", handleRevokeSession)
+
+	// Groups
+	mux.HandleFunc("GET /api/groups", handleListGroups)
+	mux.HandleFunc("POST /api/groups", handleCreateGroup)
+	mux.HandleFunc("POST /api/groups/join", handleJoinGroup)
+	mux.HandleFunc("GET /api/groups/{id}", handleGetGroup)
+	mux.HandleFunc("GET /api/groups/{id}/leaderboard", handleGetGroupLeaderboard)
+	mux.HandleFunc("POST /api/groups/{id}/leave", handleLeaveGroup)
+	mux.HandleFunc("POST /api/groups/{id}/remove", handleRemoveGroupMember)
+
+	// Friends
+	mux.HandleFunc("GET /api/friends", handleListFriends)
+	mux.HandleFunc("POST /api/friends/request", handleFriendRequest)
+	mux.HandleFunc("POST /api/friends/accept", handleAcceptFriend)
+	mux.HandleFunc("POST /api/friends/decline", handleDeclineFriend)
+	mux.HandleFunc("POST /api/friends/remove", handleRemoveFriend)
+	mux.HandleFunc("GET /api/friends/leaderboard", handleGetFriendsLeaderboard)
+	mux.HandleFunc("GET /api/friends/today", handleGetFriendsToday)
+
+	// Admin routes
+	mux.HandleFunc("POST /api/admin/ban", requireRole(roleModerator, handleBanUser))
+	mux.HandleFunc("GET /api/admin/users", requireRole(roleModerator, handleListUsers))
+	mux.HandleFunc("GET /api/admin/users/{id}", requireRole(roleModerator, handleGetUserDetail))
+	mux.HandleFunc("POST /api/admin/void-result", requireRole(roleModerator, handleVoidResult))
+	mux.HandleFunc("POST /api/admin/reset-name", requireRole(roleModerator, handleResetName))
+	mux.HandleFunc("GET /api/admin/audit", requireRole(roleAdmin, handleListAudit))
+	mux.HandleFunc("POST /api/admin/backup", requireRole(roleAdmin, handleAdminBackup))
+	mux.HandleFunc("POST /api/admin/merge", requireRole(roleAdmin, handleAdminMerge))
+	mux.HandleFunc("GET /api/admin/roles", requireRole(roleAdmin, handleListStaff))
+	mux.HandleFunc("POST /api/admin/roles/grant", requireRole(roleAdmin, handleGrantRole))
+	mux.HandleFunc("POST /api/admin/roles/revoke", requireRole(roleAdmin, handleRevokeRole))
 
 	// Static files - serve from current directory
 	staticDir := "./static"
@@ -43,6 +98,10 @@ func main() {
 			http.NotFound(w, r)
 			return
 		}
+		if r.URL.Path == "/" {
+			serveIndex(w, r, staticDir)
+			return
+		}
 		fs.ServeHTTP(w, r)
 	})
 
@@ -54,3 +113,61 @@ func main() {
 	log.Printf("Wordle Six server starting on :%s", port)
 	log.Fatal(http.ListenAndServe(":"+port, mux))
 }
+
+// runCommand handles maintenance subcommands, e.g. `wordle-six migrate status`.
+// restore must be run with the server stopped.
+func runCommand(args []string) {
+	switch {
+	case len(args) == 1 && args[0] == "migrate":
+		if err := initDB(); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+	case len(args) == 2 && args[0] == "migrate" && args[1] == "status":
+		if err := openDB(); err != nil {
+			log.Fatalf("Failed to open database: %v", err)
+		}
+		if err := printMigrationStatus(); err != nil {
+			log.Fatalf("Failed to read migrations: %v", err)
+		}
+	case len(args) == 1 && args[0] == "backup":
+		if err := openDB(); err != nil {
+			log.Fatalf("Failed to open database: %v", err)
+		}
+		if _, err := backupDatabase(); err != nil {
+			log.Fatalf("Backup failed: %v", err)
+		}
+	case len(args) == 2 && args[0] == "restore":
+		if err := restoreDatabase(args[1]); err != nil {
+			log.Fatalf("Restore failed: %v", err)
+		}
+	case len(args) == 1 && args[0] == "keys":
+		if err := openDB(); err != nil {
+			log.Fatalf("Failed to open database: %v", err)
+		}
+		if err := printSigningKeys(); err != nil {
+			log.Fatalf("Failed to read signing keys: %v", err)
+		}
+	case len(args) == 2 && args[0] == "keys" && args[1] == "rotate":
+		if err := initDB(); err != nil {
+			log.Fatalf("Failed to initialize database: %v", err)
+		}
+		k, err := rotateSigningKey()
+		if err != nil {
+			log.Fatalf("Rotation failed: %v", err)
+		}
+		audit(nil, 0, "keys.rotate", 0, nil, map[string]interface{}{"kid": k.ID})
+		log.Printf("New signing key %s; previous keys verify existing sessions until they expire", k.ID)
+	case len(args) == 3 && args[0] == "keys" && args[1] == "revoke":
+		if err := initDB(); err != nil {
+			log.Fatalf("Failed to initialize database: %v", err)
+		}
+		if err := revokeSigningKey(args[2]); err != nil {
+			log.Fatalf("Revoke failed: %v", err)
+		}
+		audit(nil, 0, "keys.revoke", 0, map[string]interface{}{"kid": args[2]}, nil)
+		log.Printf("Revoked signing key %s; sessions it signed are no longer valid", args[2])
+	default:
+		fmt.Fprintf(os.Stderr, "usage: %s [migrate [status] | backup | restore FILE | keys [rotate | revoke KID]]\n", os.Args[0])
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// migration is one numbered schema or data change. Each runs in its own
+// transaction and is recorded in schema_migrations once it commits, so it is
+// applied exactly once. Append new migrations to the end of the list; never
+// renumber or edit one that has shipped.
+type migration struct {
+	version int
+	name    string
+	up      func(tx *sql.Tx) error
+}
+
+var migrations = []migration{
+	{1, "legacy user and stats columns", migrateLegacyColumns},
+	{2, "revoke hard mode on rule-breaking results", migrateHardModeResults},
+	{3, "rebuild user_stats from game_results", rebuildUserStatsTx},
+	{4, "users.deleted_at", sqlMigration(`
+		ALTER TABLE users ADD COLUMN deleted_at DATETIME;
+	`)},
+	{5, "identities", sqlMigration(`
+		CREATE TABLE identities (
+			id INTEGER PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id),
+			provider TEXT NOT NULL,
+			provider_id TEXT NOT NULL,
+			display_name TEXT NOT NULL DEFAULT '',
+			avatar_url TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE(provider, provider_id),
+			UNIQUE(user_id, provider)
+		);
+		INSERT INTO identities (user_id, provider, provider_id, display_name, avatar_url, created_at)
+			SELECT id, provider, provider_id, display_name, avatar_url, created_at
+			FROM users WHERE deleted_at IS NULL;
+	`)},
+	{6, "sessions", sqlMigration(`
+		CREATE TABLE sessions (
+			id TEXT PRIMARY KEY,
+			user_id INTEGER NOT NULL REFERENCES users(id),
+			user_agent TEXT NOT NULL DEFAULT '',
+			created_at DATETIME NOT NULL,
+			last_seen_at DATETIME NOT NULL,
+			expires_at DATETIME NOT NULL
+		);
+		CREATE INDEX idx_sessions_user ON sessions(user_id);
+	`)},
+	{7, "signing_keys", sqlMigration(`
+		CREATE TABLE signing_keys (
+			id TEXT PRIMARY KEY,
+			secret TEXT NOT NULL,
+			created_at DATETIME NOT NULL,
+			retired_at DATETIME
+		);
+	`)},
+	// User 1 was the only admin before roles existed
+	{8, "users.role", sqlMigration(`
+		ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT '';
+		UPDATE users SET role = 'admin' WHERE id = 1 AND deleted_at IS NULL;
+	`)},
+	{9, "audit_log and voided_results", sqlMigration(`
+		CREATE TABLE audit_log (
+			id INTEGER PRIMARY KEY,
+			created_at DATETIME NOT NULL,
+			actor_id INTEGER,
+			action TEXT NOT NULL,
+			target_id INTEGER,
+			before_json TEXT,
+			after_json TEXT,
+			ip TEXT NOT NULL DEFAULT ''
+		);
+		CREATE INDEX idx_audit_log_actor ON audit_log(actor_id, id);
+		CREATE INDEX idx_audit_log_target ON audit_log(target_id, id);
+		CREATE INDEX idx_audit_log_action ON audit_log(action, id);
+
+		CREATE TABLE voided_results (
+			user_id INTEGER NOT NULL REFERENCES users(id),
+			date TEXT NOT NULL,
+			voided_at DATETIME NOT NULL,
+			PRIMARY KEY (user_id, date)
+		);
+	`)},
+	{10, "leaderboard_daily", migrateLeaderboardDaily},
+}
+
+// sqlMigration runs plain schema statements, adapted for the backend.
+func sqlMigration(stmts string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(ddl(stmts))
+		return err
+	}
+}
+
+func createMigrationsTable() error {
+	_, err := db.Exec(ddl(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY NOT NULL,
+			name TEXT NOT NULL,
+			applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)
+	`))
+	return err
+}
+
+// appliedMigrations returns the versions already recorded.
+func appliedMigrations() (map[int]string, error) {
+	rows, err := db.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]string{}
+	for rows.Next() {
+		var version int
+		var at string
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+// runMigrations applies every pending migration in order and stops at the
+// first failure, leaving that migration rolled back.
+func runMigrations() error {
+	if err := createMigrationsTable(); err != nil {
+		return err
+	}
+	applied, err := appliedMigrations()
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if _, ok := applied[m.version]; ok {
+			continue
+		}
+		if err := applyMigration(m); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+		}
+		log.Printf("Applied migration %d: %s", m.version, m.name)
+	}
+	return nil
+}
+
+func applyMigration(m migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := m.up(tx); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("INSERT INTO schema_migrations (version, name) VALUES (?, ?)", m.version, m.name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// schemaVersion returns the highest applied migration, or 0 for none.
+func schemaVersion(q querier) (int, error) {
+	var version int
+	err := q.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	return version, err
+}
+
+// latestSchemaVersion is the version this binary migrates to.
+func latestSchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// printMigrationStatus lists each migration and whether it has been applied,
+// for `wordle-six migrate status`.
+func printMigrationStatus() error {
+	if err := createMigrationsTable(); err != nil {
+		return err
+	}
+	applied, err := appliedMigrations()
+	if err != nil {
+		return err
+	}
+
+	pending := 0
+	for _, m := range migrations {
+		if at, ok := applied[m.version]; ok {
+			fmt.Printf("%4d  applied %s  %s\n", m.version, at, m.name)
+		} else {
+			fmt.Printf("%4d  pending                     %s\n", m.version, m.name)
+			pending++
+		}
+	}
+	for version := range applied {
+		if version > latestSchemaVersion() {
+			fmt.Printf("%4d  applied by a newer build\n", version)
+		}
+	}
+	fmt.Printf("%d applied, %d pending\n", len(migrations)-pending, pending)
+	return nil
+}
+
+// addColumnIfMissing adds a column unless the table already has it. Tables
+// created by createTables already include these, but databases from before
+// they existed need them added.
+func addColumnIfMissing(tx *sql.Tx, table, column, decl string) error {
+	rows, err := tx.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	_, err = tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, decl))
+	return err
+}
+
+func migrateLegacyColumns(tx *sql.Tx) error {
+	// Only SQLite databases predate these columns
+	if store.Name() != "sqlite" {
+		return nil
+	}
+	cols := []struct{ table, column, decl string }{
+		{"users", "custom_name", "TEXT"},
+		{"users", "banned", "BOOLEAN NOT NULL DEFAULT FALSE"},
+		{"user_stats", "played_hard", "INTEGER NOT NULL DEFAULT 0"},
+		{"user_stats", "won_hard", "INTEGER NOT NULL DEFAULT 0"},
+	}
+	for _, c := range cols {
+		if err := addColumnIfMissing(tx, c.table, c.column, c.decl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateHardModeResults clears hard_mode on results recorded before the
+// server checked it, where the saved guesses show the rules were broken.
+// Results with no saved game are left alone since there is nothing to check.
+func migrateHardModeResults(tx *sql.Tx) error {
+	rows, err := tx.Query(`
+		SELECT r.id, r.date, p.guesses
+		FROM game_results r
+		JOIN game_progress p ON p.user_id = r.user_id AND p.date = r.date
+		WHERE r.hard_mode = TRUE
+	`)
+	if err != nil {
+		return err
+	}
+	var revoke []int64
+	for rows.Next() {
+		var id int64
+		var date, guessesJSON string
+		if err := rows.Scan(&id, &date, &guessesJSON); err != nil {
+			rows.Close()
+			return err
+		}
+		puzzle, err := puzzleForDate(date)
+		if err != nil {
+			continue
+		}
+		// Saved guesses that can't be read can't show the game was compliant
+		var guesses []string
+		err = json.Unmarshal([]byte(guessesJSON), &guesses)
+		if err == nil {
+			guesses, err = validateGuesses(guesses)
+		}
+		if err != nil || !hardModeCompliant(guesses, puzzle.Answer()) {
+			revoke = append(revoke, id)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return err
+	}
+	rows.Close()
+
+	for _, id := range revoke {
+		if _, err := tx.Exec("UPDATE game_results SET hard_mode = FALSE WHERE id = ?", id); err != nil {
+			return err
+		}
+	}
+	log.Printf("Revoked hard mode on %d results", len(revoke))
+	return nil
+}
+
+// migrateLeaderboardDaily creates the leaderboard's per-day totals and fills
+// them from game_results. From then on they're written alongside each result.
+func migrateLeaderboardDaily(tx *sql.Tx) error {
+	_, err := tx.Exec(ddl(`
+		CREATE TABLE leaderboard_daily (
+			date TEXT NOT NULL,
+			user_id INTEGER NOT NULL REFERENCES users(id),
+			games INTEGER NOT NULL,
+			wins INTEGER NOT NULL,
+			hard_wins INTEGER NOT NULL,
+			score_tenths INTEGER NOT NULL,
+			guess_sum INTEGER NOT NULL,
+			PRIMARY KEY (date, user_id)
+		);
+		CREATE INDEX idx_leaderboard_daily_user ON leaderboard_daily(user_id);
+	`))
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(leaderboardDailySQL)
+	return err
+}
+
+func rebuildUserStatsTx(tx *sql.Tx) error {
+	return rebuildAllUserStats(tx)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMigrateHardModeResults(t *testing.T) {
+	useTestDB(t)
+	puzzle, err := puzzleForDate("2024-01-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	answer := puzzle.Answer()
+	// Any word with a letter the answer lacks: guessing it twice reuses an
+	// eliminated letter
+	var miss string
+	for _, w := range dailyWords {
+		if strings.ContainsFunc(w, func(r rune) bool { return !strings.ContainsRune(answer, r) }) {
+			miss = w
+			break
+		}
+	}
+
+	games := []struct {
+		guesses string
+		keep    bool
+	}{
+		{`["` + answer + `"]`, true},
+		{`["` + miss + `","` + answer + `"]`, true},
+		{`["` + miss + `","` + miss + `","` + answer + `"]`, false},
+		{`not json`, false},
+	}
+	for i, g := range games {
+		userID := i + 1
+		if _, err := db.Exec("INSERT INTO users (id, provider, provider_id, display_name) VALUES (?, 'github', ?, 'Player')", userID, userID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec("INSERT INTO game_results (user_id, date, won, guesses, hard_mode) VALUES (?, '2024-01-01', TRUE, 1, TRUE)", userID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec("INSERT INTO game_progress (user_id, date, guesses, hard_mode, game_over, won) VALUES (?, '2024-01-01', ?, TRUE, TRUE, TRUE)", userID, g.guesses); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrateHardModeResults(tx); err != nil {
+		tx.Rollback()
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, g := range games {
+		var hardMode bool
+		if err := db.QueryRow("SELECT hard_mode FROM game_results WHERE user_id = ?", i+1).Scan(&hardMode); err != nil {
+			t.Fatal(err)
+		}
+		if hardMode != g.keep {
+			t.Errorf("guesses %s: hard_mode = %v, want %v", g.guesses, hardMode, g.keep)
+		}
+	}
+}
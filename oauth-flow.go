@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/url"
+	"strings"
+)
+
+// oauthFlow is what handleAuthStart remembers for the callback, kept in the
+// short-lived oauth_state cookie. Verifier is the PKCE code_verifier and Nonce
+// the value the OIDC ID token must echo; either is empty when the provider
+// doesn't use it.
+type oauthFlow struct {
+	State    string `json:"state"`
+	Verifier string `json:"verifier,omitempty"`
+	Nonce    string `json:"nonce,omitempty"`
+}
+
+func (f oauthFlow) encode() string {
+	b, _ := json.Marshal(f)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeOAuthFlow(s string) (oauthFlow, bool) {
+	var f oauthFlow
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || json.Unmarshal(b, &f) != nil || f.State == "" {
+		return f, false
+	}
+	return f, true
+}
+
+// newOAuthState returns a random CSRF token with the post-login return path
+// appended, so the provider hands it back to the callback unchanged.
+func newOAuthState(returnTo string) string {
+	state := randomToken(16)
+	if returnTo != "/" {
+		state += "." + base64.RawURLEncoding.EncodeToString([]byte(returnTo))
+	}
+	return state
+}
+
+// returnPathFromState extracts the return path from a state that has already
+// been checked against the cookie. It's validated again regardless.
+func returnPathFromState(state string) string {
+	_, encoded, ok := strings.Cut(state, ".")
+	if !ok {
+		return "/"
+	}
+	b, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "/"
+	}
+	return safeReturnPath(string(b))
+}
+
+// safeReturnPath only lets through local paths, so the return URL can't be
+// used to bounce a freshly signed-in user to another site.
+func safeReturnPath(p string) string {
+	if !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") || strings.ContainsAny(p, "\\\r\n") {
+		return "/"
+	}
+	u, err := url.Parse(p)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.User != nil {
+		return "/"
+	}
+	return u.RequestURI()
+}
+
+// statesEqual compares the callback's state with the cookie's in constant
+// time.
+func statesEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// pkceChallenge is the S256 code_challenge for a code_verifier.
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func randomToken(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
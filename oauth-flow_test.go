@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSafeReturnPath(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"/", "/"},
+		{"/stats", "/stats"},
+		{"/stats?period=week", "/stats?period=week"},
+		{"/stats#top", "/stats"},
+		{"", "/"},
+		{"stats", "/"},
+		{"//evil.com", "/"},
+		{"//evil.com/path", "/"},
+		{`/\evil.com`, "/"},
+		{`\\evil.com`, "/"},
+		{"https://x", "/"},
+		{"javascript:alert(1)", "/"},
+		{"/a\r\nSet-Cookie: session=x", "/"},
+		{"/a\nb", "/"},
+		{"/%2F%2Fevil.com", "/%2F%2Fevil.com"},
+	}
+	for _, tt := range tests {
+		if got := safeReturnPath(tt.in); got != tt.want {
+			t.Errorf("safeReturnPath(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestReturnPathFromState(t *testing.T) {
+	b64 := base64.RawURLEncoding.EncodeToString
+	tests := []struct{ state, want string }{
+		{newOAuthState("/"), "/"},
+		{newOAuthState("/stats?period=week"), "/stats?period=week"},
+		{"abc", "/"},
+		{"abc." + b64([]byte("//evil.com")), "/"},
+		{"abc." + b64([]byte("https://evil.com")), "/"},
+		{"abc." + b64([]byte("/a\r\nLocation: x")), "/"},
+		{"abc.!!not-base64!!", "/"},
+	}
+	for _, tt := range tests {
+		if got := returnPathFromState(tt.state); got != tt.want {
+			t.Errorf("returnPathFromState(%q) = %q, want %q", tt.state, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeOAuthFlow(t *testing.T) {
+	flow := oauthFlow{State: "s", Verifier: "v", Nonce: "n"}
+	if got, ok := decodeOAuthFlow(flow.encode()); !ok || got != flow {
+		t.Errorf("round trip = %+v, %v", got, ok)
+	}
+
+	b64 := base64.RawURLEncoding.EncodeToString
+	for _, cookie := range []string{
+		"",
+		"not base64!",
+		b64([]byte("not json")),
+		b64([]byte(`{"state":""}`)),
+		b64([]byte(`{"verifier":"v"}`)),
+		flow.encode() + "x",
+	} {
+		if got, ok := decodeOAuthFlow(cookie); ok {
+			t.Errorf("decodeOAuthFlow(%q) = %+v, want rejected", cookie, got)
+		}
+	}
+}
+
+// TestAuthCallbackState checks the callback refuses to go on without a
+// cookie whose state matches the one the provider sent back.
+func TestAuthCallbackState(t *testing.T) {
+	tests := []struct {
+		name   string
+		cookie *http.Cookie
+		state  string
+	}{
+		{"no cookie", nil, "s"},
+		{"empty cookie", &http.Cookie{Name: "oauth_state", Value: ""}, "s"},
+		{"garbled cookie", &http.Cookie{Name: "oauth_state", Value: "%%%"}, "s"},
+		{"tampered state", &http.Cookie{Name: "oauth_state", Value: oauthFlow{State: "s"}.encode()}, "s2"},
+		{"no state", &http.Cookie{Name: "oauth_state", Value: oauthFlow{State: "s"}.encode()}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/auth/github/callback?code=c&state="+tt.state, nil)
+			r.SetPathValue("provider", "github")
+			if tt.cookie != nil {
+				r.AddCookie(tt.cookie)
+			}
+			w := httptest.NewRecorder()
+			handleAuthCallback(w, r)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status %d, want 400", w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Generic OpenID Connect providers are configured entirely from the
+// environment. OIDC_PROVIDERS lists their IDs (e.g. "corp,keycloak"), each of
+// which becomes /auth/{id} and is set up with variables prefixed
+// OIDC_{ID}_ (upper-cased, dashes as underscores):
+//
+//	ISSUER         issuer URL; endpoints come from its discovery document
+//	CLIENT_ID      \
+//	CLIENT_SECRET  / as registered with the IdP
+//	NAME           button label (default: the ID)
+//	SCOPES         default "openid profile"
+//	ID_CLAIM       claim holding the stable user ID (default "sub")
+//	NAME_CLAIM     display name (default "name", then "preferred_username")
+//	AVATAR_CLAIM   avatar URL (default "picture")
+//
+// Users are identified by verifying the ID token against the issuer's JWKS.
+// Claims missing from it are looked up at the userinfo endpoint.
+type oidcProvider struct {
+	ID           string
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       string
+	IDClaim      string
+	NameClaim    string
+	AvatarClaim  string
+
+	mu           sync.Mutex
+	discovery    *oidcDiscovery
+	discoveredAt time.Time
+	keys         map[string]interface{}
+	keysFetched  time.Time
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+
+	CodeChallengeMethodsSupported []string `json:"code_challenge_methods_supported"`
+}
+
+var (
+	oidcProviders     = map[string]*oidcProvider{}
+	oidcProviderOrder []string
+)
+
+// builtinProviders are the providers with their own case in getOAuthConfig.
+var builtinProviders = []struct{ ID, Name string }{
+	{"github", "GitHub"},
+	{"discord", "Discord"},
+	{"google", "Google"},
+}
+
+func isBuiltinProvider(id string) bool {
+	for _, p := range builtinProviders {
+		if p.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+var errOIDCUnavailable = errors.New("identity provider unavailable")
+
+var providerIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+func init() {
+	for _, id := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		id = strings.ToLower(strings.TrimSpace(id))
+		if id == "" {
+			continue
+		}
+		if !providerIDPattern.MatchString(id) {
+			fmt.Fprintf(os.Stderr, "OIDC_PROVIDERS: invalid provider ID %q, ignoring\n", id)
+			continue
+		}
+		if isBuiltinProvider(id) || id == "me" || id == "providers" || id == "logout" {
+			fmt.Fprintf(os.Stderr, "OIDC_PROVIDERS: %q clashes with a built-in provider or route, ignoring\n", id)
+			continue
+		}
+		env := func(key, def string) string {
+			if v := os.Getenv("OIDC_" + strings.ToUpper(strings.ReplaceAll(id, "-", "_")) + "_" + key); v != "" {
+				return v
+			}
+			return def
+		}
+		oidcProviders[id] = &oidcProvider{
+			ID:           id,
+			Name:         env("NAME", id),
+			Issuer:       strings.TrimSuffix(env("ISSUER", ""), "/"),
+			ClientID:     env("CLIENT_ID", ""),
+			ClientSecret: env("CLIENT_SECRET", ""),
+			Scopes:       env("SCOPES", "openid profile"),
+			IDClaim:      env("ID_CLAIM", "sub"),
+			NameClaim:    env("NAME_CLAIM", ""),
+			AvatarClaim:  env("AVATAR_CLAIM", "picture"),
+		}
+		oidcProviderOrder = append(oidcProviderOrder, id)
+	}
+}
+
+// config resolves the provider's endpoints from its discovery document,
+// which is cached for an hour.
+func (p *oidcProvider) config() (*oauthConfig, error) {
+	cfg := &oauthConfig{
+		ClientID:     p.ClientID,
+		ClientSecret: p.ClientSecret,
+		Scopes:       p.Scopes,
+		OIDC:         p,
+	}
+	if p.ClientID == "" || p.Issuer == "" {
+		// Reported as "not configured" by the caller
+		cfg.ClientID = ""
+		return cfg, nil
+	}
+
+	d, err := p.discover()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", errOIDCUnavailable, p.ID, err)
+	}
+	cfg.AuthURL = d.AuthorizationEndpoint
+	cfg.TokenURL = d.TokenEndpoint
+	cfg.UserInfoURL = d.UserinfoEndpoint
+	for _, m := range d.CodeChallengeMethodsSupported {
+		if m == "S256" {
+			cfg.PKCE = true
+		}
+	}
+	return cfg, nil
+}
+
+func (p *oidcProvider) discover() (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil && time.Since(p.discoveredAt) < time.Hour {
+		return p.discovery, nil
+	}
+
+	var d oidcDiscovery
+	if err := getJSON(p.Issuer+"/.well-known/openid-configuration", &d); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(d.Issuer, "/") != p.Issuer {
+		return nil, fmt.Errorf("discovery document is for issuer %q", d.Issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, errors.New("discovery document is missing endpoints")
+	}
+	p.discovery = &d
+	p.discoveredAt = time.Now()
+	return p.discovery, nil
+}
+
+// key returns the issuer's signing key with the given ID, refetching the
+// JWKS (at most once a minute) when it isn't known, since IdPs rotate keys.
+func (p *oidcProvider) key(kid string) (interface{}, error) {
+	d, err := p.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	lookup := func() interface{} {
+		if kid == "" && len(p.keys) == 1 {
+			for _, k := range p.keys {
+				return k
+			}
+		}
+		return p.keys[kid]
+	}
+	if k := lookup(); k != nil {
+		return k, nil
+	}
+	if time.Since(p.keysFetched) < time.Minute {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	p.keysFetched = time.Now()
+	if err := getJSON(d.JWKSURI, &set); err != nil {
+		return nil, err
+	}
+	p.keys = map[string]interface{}{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if k, err := jwk.publicKey(); err == nil {
+			p.keys[jwk.Kid] = k
+		}
+	}
+	if k := lookup(); k != nil {
+		return k, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// verifyIDToken checks the ID token's signature, issuer, audience, expiry and
+// nonce and returns its claims.
+func (p *oidcProvider) verifyIDToken(d *oidcDiscovery, raw, nonce string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.key(kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(d.Issuer),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if got, _ := claims["nonce"].(string); !statesEqual(got, nonce) {
+		return nil, errors.New("nonce mismatch")
+	}
+	return claims, nil
+}
+
+// profile identifies the user from the token response: the ID token's
+// claims, topped up from userinfo when the name or avatar claim is absent.
+func (p *oidcProvider) profile(tokenResp map[string]interface{}, accessToken, nonce string) (providerID, displayName, avatarURL string, err error) {
+	rawIDToken, _ := tokenResp["id_token"].(string)
+	if rawIDToken == "" {
+		return "", "", "", errors.New("no id_token in token response")
+	}
+	d, err := p.discover()
+	if err != nil {
+		return "", "", "", err
+	}
+	claims, err := p.verifyIDToken(d, rawIDToken, nonce)
+	if err != nil {
+		return "", "", "", fmt.Errorf("invalid ID token: %w", err)
+	}
+
+	providerID = claimString(claims, p.IDClaim)
+	if providerID == "" {
+		return "", "", "", fmt.Errorf("ID token has no %q claim", p.IDClaim)
+	}
+	displayName, avatarURL = p.nameAndAvatar(claims)
+
+	if (displayName == "" || avatarURL == "") && d.UserinfoEndpoint != "" {
+		var info map[string]interface{}
+		req, _ := http.NewRequest("GET", d.UserinfoEndpoint, nil)
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		// userinfo must describe the same subject as the ID token
+		if err := doJSON(req, &info); err == nil && claimString(info, "sub") == claimString(claims, "sub") {
+			name, avatar := p.nameAndAvatar(info)
+			if displayName == "" {
+				displayName = name
+			}
+			if avatarURL == "" {
+				avatarURL = avatar
+			}
+		}
+	}
+	if displayName == "" {
+		displayName = p.Name + " user"
+	}
+	return providerID, displayName, avatarURL, nil
+}
+
+func (p *oidcProvider) nameAndAvatar(claims map[string]interface{}) (string, string) {
+	var name string
+	if p.NameClaim != "" {
+		name = claimString(claims, p.NameClaim)
+	} else {
+		name = claimString(claims, "name")
+		if name == "" {
+			name = claimString(claims, "preferred_username")
+		}
+	}
+	return name, claimString(claims, p.AvatarClaim)
+}
+
+func claimString(claims map[string]interface{}, name string) string {
+	switch v := claims[name].(type) {
+	case string:
+		return v
+	case float64:
+		return fmt.Sprintf("%.0f", v)
+	}
+	return ""
+}
+
+// jsonWebKey is one entry of a JWKS. Only RSA and EC signing keys are used.
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (interface{}, error) {
+	num := func(s string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+
+	switch k.Kty {
+	case "RSA":
+		n, err := num(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := num(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := num(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := num(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+var oidcClient = &http.Client{Timeout: 10 * time.Second}
+
+func getJSON(url string, v interface{}) error {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return err
+	}
+	return doJSON(req, v)
+}
+
+func doJSON(req *http.Request, v interface{}) error {
+	req.Header.Set("Accept", "application/json")
+	resp, err := oidcClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %d", req.URL, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// handleAuthProviders lists the sign-in options for the login menu.
+func handleAuthProviders(w http.ResponseWriter, r *http.Request) {
+	providers := []map[string]string{}
+	for _, p := range builtinProviders {
+		providers = append(providers, map[string]string{"id": p.ID, "name": p.Name})
+	}
+	for _, id := range oidcProviderOrder {
+		providers = append(providers, map[string]string{"id": id, "name": oidcProviders[id].Name})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"providers": providers})
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fakeIdP is an OpenID Connect provider serving discovery, a JWKS, a token
+// endpoint and userinfo. The token endpoint hands out idToken for code
+// "good-code".
+type fakeIdP struct {
+	srv    *httptest.Server
+	rsaKey *rsa.PrivateKey
+	ecKey  *ecdsa.PrivateKey
+
+	mu       sync.Mutex
+	jwks     []map[string]string
+	jwksHits int
+	idToken  string
+	userinfo map[string]interface{}
+}
+
+func newFakeIdP(t *testing.T) *fakeIdP {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeIdP{rsaKey: rsaKey, ecKey: ecKey}
+	f.jwks = []map[string]string{rsaJWK("rsa-1", &rsaKey.PublicKey), ecJWK("ec-1", &ecKey.PublicKey)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                           f.srv.URL,
+			"authorization_endpoint":           f.srv.URL + "/authorize",
+			"token_endpoint":                   f.srv.URL + "/token",
+			"userinfo_endpoint":                f.srv.URL + "/userinfo",
+			"jwks_uri":                         f.srv.URL + "/jwks",
+			"code_challenge_methods_supported": []string{"S256"},
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.jwksHits++
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": f.jwks})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("code") != "good-code" || r.FormValue("grant_type") != "authorization_code" || r.FormValue("client_id") != "client" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "access", "token_type": "Bearer", "id_token": f.idToken})
+	})
+	mux.HandleFunc("GET /userinfo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		json.NewEncoder(w).Encode(f.userinfo)
+	})
+	f.srv = httptest.NewServer(mux)
+	t.Cleanup(f.srv.Close)
+	return f
+}
+
+// provider returns a fresh client for the IdP, with nothing cached.
+func (f *fakeIdP) provider() *oidcProvider {
+	return &oidcProvider{
+		ID:          "test",
+		Name:        "Test",
+		Issuer:      f.srv.URL,
+		ClientID:    "client",
+		Scopes:      "openid profile",
+		IDClaim:     "sub",
+		AvatarClaim: "picture",
+	}
+}
+
+// claims returns valid ID token claims for nonce "n", with overrides applied
+// (a nil value removes the claim).
+func (f *fakeIdP) claims(overrides jwt.MapClaims) jwt.MapClaims {
+	c := jwt.MapClaims{
+		"iss":   f.srv.URL,
+		"aud":   "client",
+		"sub":   "user-1",
+		"exp":   time.Now().Add(5 * time.Minute).Unix(),
+		"iat":   time.Now().Unix(),
+		"nonce": "n",
+		"name":  "Test User",
+	}
+	for k, v := range overrides {
+		if v == nil {
+			delete(c, k)
+		} else {
+			c[k] = v
+		}
+	}
+	return c
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, key interface{}, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	tok := jwt.NewWithClaims(method, claims)
+	tok.Header["kid"] = kid
+	raw, err := tok.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func b64(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+func rsaJWK(kid string, k *rsa.PublicKey) map[string]string {
+	return map[string]string{"kid": kid, "kty": "RSA", "use": "sig", "n": b64(k.N.Bytes()), "e": b64(big.NewInt(int64(k.E)).Bytes())}
+}
+
+func ecJWK(kid string, k *ecdsa.PublicKey) map[string]string {
+	return map[string]string{"kid": kid, "kty": "EC", "crv": "P-256", "x": b64(k.X.FillBytes(make([]byte, 32))), "y": b64(k.Y.FillBytes(make([]byte, 32)))}
+}
+
+func TestOIDCVerifyIDToken(t *testing.T) {
+	f := newFakeIdP(t)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		nonce   string
+		wantErr string
+	}{
+		{"valid RS256", sign(t, jwt.SigningMethodRS256, f.rsaKey, "rsa-1", f.claims(nil)), "n", ""},
+		{"valid ES256", sign(t, jwt.SigningMethodES256, f.ecKey, "ec-1", f.claims(nil)), "n", ""},
+		{"audience list", sign(t, jwt.SigningMethodRS256, f.rsaKey, "rsa-1", f.claims(jwt.MapClaims{"aud": []string{"other", "client"}})), "n", ""},
+		{"expired within leeway", sign(t, jwt.SigningMethodRS256, f.rsaKey, "rsa-1", f.claims(jwt.MapClaims{"exp": time.Now().Add(-30 * time.Second).Unix()})), "n", ""},
+		{"wrong audience", sign(t, jwt.SigningMethodRS256, f.rsaKey, "rsa-1", f.claims(jwt.MapClaims{"aud": "someone-else"})), "n", "audience"},
+		{"wrong issuer", sign(t, jwt.SigningMethodRS256, f.rsaKey, "rsa-1", f.claims(jwt.MapClaims{"iss": "https://evil.example"})), "n", "issuer"},
+		{"expired", sign(t, jwt.SigningMethodRS256, f.rsaKey, "rsa-1", f.claims(jwt.MapClaims{"exp": time.Now().Add(-5 * time.Minute).Unix()})), "n", "expired"},
+		{"no expiry", sign(t, jwt.SigningMethodRS256, f.rsaKey, "rsa-1", f.claims(jwt.MapClaims{"exp": nil})), "n", "exp"},
+		{"nonce mismatch", sign(t, jwt.SigningMethodRS256, f.rsaKey, "rsa-1", f.claims(nil)), "other", "nonce mismatch"},
+		{"no nonce", sign(t, jwt.SigningMethodRS256, f.rsaKey, "rsa-1", f.claims(jwt.MapClaims{"nonce": nil})), "n", "nonce mismatch"},
+		{"signed by another key", sign(t, jwt.SigningMethodRS256, otherKey, "rsa-1", f.claims(nil)), "n", "signature"},
+		{"HMAC with the client ID", sign(t, jwt.SigningMethodHS256, []byte("client"), "rsa-1", f.claims(nil)), "n", "signing method"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := f.provider()
+			d, err := p.discover()
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims, err := p.verifyIDToken(d, tt.token, tt.nonce)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("verifyIDToken: %v", err)
+				}
+				if claims["sub"] != "user-1" {
+					t.Errorf("sub = %v", claims["sub"])
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("verifyIDToken error = %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestOIDCKeyRotation checks that a token signed with a key the provider
+// hasn't seen triggers a JWKS refetch, but at most once a minute.
+func TestOIDCKeyRotation(t *testing.T) {
+	f := newFakeIdP(t)
+	p := f.provider()
+	d, err := p.discover()
+	if err != nil {
+		t.Fatal(err)
+	}
+	verify := func(key interface{}, kid string) error {
+		_, err := p.verifyIDToken(d, sign(t, jwt.SigningMethodRS256, key, kid, f.claims(nil)), "n")
+		return err
+	}
+	hits := func() int {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		return f.jwksHits
+	}
+
+	if err := verify(f.rsaKey, "rsa-1"); err != nil {
+		t.Fatal(err)
+	}
+	if hits() != 1 {
+		t.Fatalf("JWKS fetched %d times, want 1", hits())
+	}
+
+	// The IdP rotates to a new key; the old fetch is over a minute ago
+	rotated, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.mu.Lock()
+	f.jwks = append(f.jwks, rsaJWK("rsa-2", &rotated.PublicKey))
+	f.mu.Unlock()
+	p.keysFetched = time.Now().Add(-2 * time.Minute)
+	if err := verify(rotated, "rsa-2"); err != nil {
+		t.Fatalf("token signed with the rotated key: %v", err)
+	}
+	if hits() != 2 {
+		t.Errorf("JWKS fetched %d times, want 2", hits())
+	}
+
+	// An unknown kid straight after a fetch is refused without another one
+	if err := verify(rotated, "rsa-3"); err == nil || !strings.Contains(err.Error(), "unknown signing key") {
+		t.Errorf("unknown kid: %v", err)
+	}
+	if hits() != 2 {
+		t.Errorf("JWKS fetched %d times after an unknown kid, want 2", hits())
+	}
+}
+
+func TestOIDCProfile(t *testing.T) {
+	f := newFakeIdP(t)
+	bare := f.claims(jwt.MapClaims{"name": nil})
+
+	tests := []struct {
+		name       string
+		claims     jwt.MapClaims
+		userinfo   map[string]interface{}
+		wantName   string
+		wantAvatar string
+	}{
+		{"name in the ID token", f.claims(jwt.MapClaims{"picture": "https://img/a.png"}), nil, "Test User", "https://img/a.png"},
+		{"topped up from userinfo", bare, map[string]interface{}{"sub": "user-1", "name": "From Userinfo", "picture": "https://img/b.png"}, "From Userinfo", "https://img/b.png"},
+		{"userinfo for another subject", bare, map[string]interface{}{"sub": "user-2", "name": "Someone Else", "picture": "https://img/c.png"}, "Test user", ""},
+		{"userinfo without a subject", bare, map[string]interface{}{"name": "Nobody"}, "Test user", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f.mu.Lock()
+			f.userinfo = tt.userinfo
+			f.mu.Unlock()
+			tokenResp := map[string]interface{}{"id_token": sign(t, jwt.SigningMethodES256, f.ecKey, "ec-1", tt.claims)}
+			id, name, avatar, err := f.provider().profile(tokenResp, "access", "n")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id != "user-1" || name != tt.wantName || avatar != tt.wantAvatar {
+				t.Errorf("profile = %q, %q, %q, want user-1, %q, %q", id, name, avatar, tt.wantName, tt.wantAvatar)
+			}
+		})
+	}
+
+	if _, _, _, err := f.provider().profile(map[string]interface{}{}, "access", "n"); err == nil {
+		t.Error("profile accepted a token response without an id_token")
+	}
+}
+
+// TestOIDCCallback runs a sign-in through handleAuthCallback: the code is
+// exchanged at the token endpoint and the ID token verified before a
+// session is started.
+func TestOIDCCallback(t *testing.T) {
+	useTestDB(t)
+	if err := loadSigningKeys(); err != nil {
+		t.Fatal(err)
+	}
+	f := newFakeIdP(t)
+	oidcProviders["test"] = f.provider()
+	t.Cleanup(func() { delete(oidcProviders, "test") })
+
+	callback := func(code, nonce string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/auth/test/callback?state=s&code="+code, nil)
+		r.SetPathValue("provider", "test")
+		r.AddCookie(&http.Cookie{Name: "oauth_state", Value: oauthFlow{State: "s", Nonce: nonce}.encode()})
+		w := httptest.NewRecorder()
+		handleAuthCallback(w, r)
+		return w
+	}
+	f.idToken = sign(t, jwt.SigningMethodRS256, f.rsaKey, "rsa-1", f.claims(nil))
+
+	if w := callback("good-code", "other"); w.Code != http.StatusUnauthorized {
+		t.Errorf("nonce mismatch: status %d, want 401", w.Code)
+	}
+
+	// A bootstrap admin is promoted on sign-in, and that is audited
+	bootstrapAdmins["test:user-1"] = true
+	t.Cleanup(func() { delete(bootstrapAdmins, "test:user-1") })
+
+	w := callback("good-code", "n")
+	if w.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var session bool
+	for _, c := range w.Result().Cookies() {
+		session = session || (c.Name == "session" && c.Value != "")
+	}
+	if !session {
+		t.Error("no session cookie set")
+	}
+	var name string
+	err := db.QueryRow("SELECT u.display_name FROM identities i JOIN users u ON u.id = i.user_id WHERE i.provider = 'test' AND i.provider_id = 'user-1'").Scan(&name)
+	if err != nil || name != "Test User" {
+		t.Errorf("signed-in user = %q, %v", name, err)
+	}
+	var role, after string
+	err = db.QueryRow(`
+		SELECT u.role, a.after_json FROM users u JOIN audit_log a ON a.target_id = u.id
+		WHERE u.display_name = 'Test User' AND a.action = 'role.grant' AND a.actor_id IS NULL
+	`).Scan(&role, &after)
+	if err != nil || role != roleAdmin || after != `{"role":"admin"}` {
+		t.Errorf("bootstrap admin: role %q, audit %s, %v", role, after, err)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	wordLength = 6
+	maxGuesses = 6
+	dateLayout = "2006-01-02"
+)
+
+// puzzleEpoch is day 0 of the puzzle calendar (Jan 1, 2024).
+var puzzleEpoch = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Puzzle identifies a single day's game.
+type Puzzle struct {
+	Number int    `json:"number"`
+	Date   string `json:"date"`
+	answer string
+}
+
+// Answer returns the puzzle's solution. It must never be sent to a client
+// before that client's game is over.
+func (p *Puzzle) Answer() string {
+	return p.answer
+}
+
+// puzzleForDate returns the puzzle for a YYYY-MM-DD date string.
+func puzzleForDate(date string) (*Puzzle, error) {
+	d, err := time.Parse(dateLayout, date)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date %q", date)
+	}
+	days := int(d.Sub(puzzleEpoch).Hours() / 24)
+	if days < 0 {
+		return nil, fmt.Errorf("date %s is before the first puzzle", date)
+	}
+	return &Puzzle{
+		Number: days,
+		Date:   date,
+		answer: dailyWords[dailyWordIndex(days)],
+	}, nil
+}
+
+// dailyWordIndex picks the day's word: every word is used once per cycle, in
+// an order reshuffled with a per-cycle seed. The order must not change, or
+// past puzzles and the results recorded for them would no longer match.
+func dailyWordIndex(days int) int {
+	n := len(dailyWords)
+	cycle := days / n
+	dayInCycle := days % n
+
+	indices := make([]int, n)
+	for i := range indices {
+		indices[i] = i
+	}
+	shuffleInts(indices, float64(cycle*77+12345))
+	return indices[dayInCycle]
+}
+
+// shuffleInts is a Fisher-Yates shuffle driven by a sin-based RNG. It was
+// ported from the browser's original createRNG(), which is what keeps the
+// schedule from before the list moved server-side; that relies on Go's
+// math.Sin matching V8's, which TestPuzzleSchedule checks against answers
+// the old words.js picked.
+func shuffleInts(a []int, seed float64) {
+	rng := func() float64 {
+		x := math.Sin(seed) * 10000
+		seed++
+		return x - math.Floor(x)
+	}
+	for i := len(a) - 1; i > 0; i-- {
+		j := int(math.Floor(rng() * float64(i+1)))
+		a[i], a[j] = a[j], a[i]
+	}
+}
+
+// isPlayableDate reports whether date is "today" somewhere on Earth, i.e.
+// between the calendar dates at UTC-12 and UTC+14. Clients send their local
+// date, so anything outside that window is a clock or timezone trick.
+func isPlayableDate(date string, now time.Time) bool {
+	now = now.UTC()
+	earliest := now.Add(-12 * time.Hour).Format(dateLayout)
+	latest := now.Add(14 * time.Hour).Format(dateLayout)
+	return date >= earliest && date <= latest
+}
+
+// currentPuzzle resolves a client-supplied date to a puzzle, rejecting dates
+// that are not currently playable.
+func currentPuzzle(date string) (*Puzzle, error) {
+	p, err := puzzleForDate(date)
+	if err != nil {
+		return nil, err
+	}
+	if !isPlayableDate(date, time.Now()) {
+		return nil, fmt.Errorf("puzzle %s is not currently playable", date)
+	}
+	return p, nil
+}
+
+func handleGetPuzzle(w http.ResponseWriter, r *http.Request) {
+	date := r.URL.Query().Get("date")
+	if date == "" {
+		date = time.Now().UTC().Format(dateLayout)
+	}
+
+	p, err := currentPuzzle(date)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
+
+// Tile states, named to match the CSS classes used by game.js.
+const (
+	tileCorrect = "correct"
+	tilePresent = "present"
+	tileAbsent  = "absent"
+)
+
+// scoreGuess colours a guess against the answer in two passes: exact matches
+// first, then remaining letters are marked present at most as many times as
+// they are still unused in the answer.
+func scoreGuess(guess, answer string) []string {
+	result := make([]string, wordLength)
+	remaining := []byte(answer)
+
+	for i := 0; i < wordLength; i++ {
+		if guess[i] == answer[i] {
+			result[i] = tileCorrect
+			remaining[i] = 0
+		}
+	}
+
+	for i := 0; i < wordLength; i++ {
+		if result[i] == tileCorrect {
+			continue
+		}
+		result[i] = tileAbsent
+		for j := 0; j < wordLength; j++ {
+			if remaining[j] == guess[i] {
+				result[i] = tilePresent
+				remaining[j] = 0
+				break
+			}
+		}
+	}
+
+	return result
+}
+
+var guessPattern = regexp.MustCompile(`^[A-Z]{6}$`)
+
+// normalizeGuess upper-cases a guess and checks it is six ASCII letters.
+func normalizeGuess(guess string) (string, bool) {
+	guess = strings.ToUpper(strings.TrimSpace(guess))
+	return guess, guessPattern.MatchString(guess)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestScoreGuess(t *testing.T) {
+	const (
+		c = tileCorrect
+		p = tilePresent
+		a = tileAbsent
+	)
+	tests := []struct {
+		guess, answer string
+		want          []string
+	}{
+		{"BETTER", "BETTER", []string{c, c, c, c, c, c}},
+		{"LETTER", "BETTER", []string{a, c, c, c, c, c}},
+		{"TRENDS", "BETTER", []string{p, p, p, a, a, a}},
+		// The first T takes the answer's spare T; the answer has no E left
+		// for the third letter
+		{"TEETER", "BETTER", []string{p, c, a, c, c, c}},
+		// Greens are matched first, so the green E leaves none for the
+		// earlier Es
+		{"EERIES", "ANSWER", []string{a, a, p, a, c, p}},
+		{"EEEEEE", "BETTER", []string{a, c, a, a, c, a}},
+		// Only one yellow per copy of the letter in the answer
+		{"RRRXXX", "BETTER", []string{p, a, a, a, a, a}},
+	}
+	for _, tt := range tests {
+		if got := scoreGuess(tt.guess, tt.answer); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("scoreGuess(%q, %q) = %v, want %v", tt.guess, tt.answer, got, tt.want)
+		}
+	}
+}
+
+// TestPuzzleSchedule pins known days to the answers the original words.js
+// picked for them, across the first two cycle boundaries (every 743 days),
+// so a change to the word list or the shuffle can't silently move past
+// puzzles.
+func TestPuzzleSchedule(t *testing.T) {
+	if len(dailyWords) != 743 {
+		t.Fatalf("dailyWords has %d words; the pinned schedule below assumes 743", len(dailyWords))
+	}
+	tests := []struct {
+		date   string
+		number int
+		answer string
+	}{
+		{"2024-01-01", 0, "BUTTON"},
+		{"2024-02-29", 59, "GUITAR"},
+		{"2025-06-15", 531, "PRAYER"},
+		{"2026-01-11", 741, "GARDEN"},
+		{"2026-01-12", 742, "FEMALE"},
+		{"2026-01-13", 743, "REFUSE"},
+		{"2026-01-14", 744, "SUPPLY"},
+		{"2028-01-25", 1485, "RAISED"},
+		{"2028-01-26", 1486, "MINUTE"},
+		{"2030-01-01", 2192, "UNIQUE"},
+	}
+	for _, tt := range tests {
+		p, err := puzzleForDate(tt.date)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.date, err)
+		}
+		if p.Number != tt.number || p.Answer() != tt.answer {
+			t.Errorf("%s: puzzle %d %s, want %d %s", tt.date, p.Number, p.Answer(), tt.number, tt.answer)
+		}
+	}
+
+	if _, err := puzzleForDate("2023-12-31"); err == nil {
+		t.Error("got a puzzle for the day before the first one")
+	}
+}
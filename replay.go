@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// GameOutcome is what the server concludes about a game by replaying its
+// guesses against the answer, independent of anything the client claims.
+type GameOutcome struct {
+	Guesses       int
+	GameOver      bool
+	Won           bool
+	HardModeValid bool // every guess obeyed the hard-mode rules
+}
+
+// replayGame scores each guess in order. Guesses must already be validated
+// and normalized; a guess made after the game ended is an error.
+func replayGame(p *Puzzle, guesses []string) (*GameOutcome, error) {
+	o := &GameOutcome{
+		Guesses:       len(guesses),
+		HardModeValid: hardModeCompliant(guesses, p.Answer()),
+	}
+	for i, g := range guesses {
+		if o.GameOver {
+			return nil, fmt.Errorf("guess %d made after the game ended", i+1)
+		}
+		if g == p.Answer() {
+			o.Won = true
+			o.GameOver = true
+		} else if i == maxGuesses-1 {
+			o.GameOver = true
+		}
+	}
+	return o, nil
+}
+
+// hardModeCompliant reports whether every guess obeyed the hard-mode rules.
+// This is also the test for turning hard mode on mid-game: like
+// canEnableHardMode() in game.js, it is only allowed if the guesses so far
+// would have been legal had it been on from the start.
+func hardModeCompliant(guesses []string, answer string) bool {
+	for i := 1; i < len(guesses); i++ {
+		if checkHardMode(guesses[i], guesses[:i], answer) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// checkHardMode mirrors checkHardMode() in game.js: revealed hints from all
+// previous guesses must be honoured by guess. The returned error carries the
+// same message the client shows.
+func checkHardMode(guess string, previous []string, answer string) error {
+	var requiredPositions [wordLength]byte          // green: position -> letter
+	var excludedPositions [wordLength]map[byte]bool // yellow: letters not allowed at position
+	requiredLetters := map[byte]bool{}
+	absentLetters := map[byte]bool{}
+
+	for _, prev := range previous {
+		result := scoreGuess(prev, answer)
+
+		for i := 0; i < wordLength; i++ {
+			switch result[i] {
+			case tileCorrect:
+				requiredPositions[i] = prev[i]
+				requiredLetters[prev[i]] = true
+			case tilePresent:
+				requiredLetters[prev[i]] = true
+				if excludedPositions[i] == nil {
+					excludedPositions[i] = map[byte]bool{}
+				}
+				excludedPositions[i][prev[i]] = true
+			}
+		}
+
+		// Only letters that aren't also green/yellow elsewhere are eliminated
+		for i := 0; i < wordLength; i++ {
+			if result[i] == tileAbsent && !requiredLetters[prev[i]] {
+				absentLetters[prev[i]] = true
+			}
+		}
+	}
+
+	for i, letter := range requiredPositions {
+		if letter != 0 && guess[i] != letter {
+			return errors.New("Correct letters must remain in place")
+		}
+	}
+	for i, letters := range excludedPositions {
+		if letters[guess[i]] {
+			return errors.New("Try revealed letters in a new spot")
+		}
+	}
+	for letter := range requiredLetters {
+		if !strings.ContainsRune(guess, rune(letter)) {
+			return errors.New("Guess must use all revealed letters")
+		}
+	}
+	for i := 0; i < wordLength; i++ {
+		if absentLetters[guess[i]] {
+			return errors.New("Cannot use eliminated letters")
+		}
+	}
+	return nil
+}
+
+// recordOutcome inserts the game_results row for a finished game. The
+// hard-mode bonus is only granted when the player asked for hard mode and
+// the replay confirms they kept to it.
+func recordOutcome(userID int64, date string, o *GameOutcome, hardMode bool) error {
+	var guessPtr *int
+	if o.Won {
+		guesses := o.Guesses
+		guessPtr = &guesses
+	}
+	return insertGameResult(userID, date, o.Won, guessPtr, hardMode && o.HardModeValid)
+}
+
+// hasPrefix reports whether guesses starts with every entry of prefix.
+func hasPrefix(guesses, prefix []string) bool {
+	if len(prefix) > len(guesses) {
+		return false
+	}
+	for i := range prefix {
+		if guesses[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
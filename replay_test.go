@@ -0,0 +1,89 @@
+package main
+
+import "testing"
+
+func TestCheckHardMode(t *testing.T) {
+	tests := []struct {
+		name     string
+		answer   string
+		previous []string
+		guess    string
+		want     string // "" for allowed
+	}{
+		{"first guess", "BETTER", nil, "LETTER", ""},
+		{"greens kept", "BETTER", []string{"LETTER"}, "SETTER", ""},
+		{"green moved", "BETTER", []string{"LETTER"}, "BATTER", "Correct letters must remain in place"},
+		{"eliminated letter reused", "BETTER", []string{"LETTER"}, "LETTER", "Cannot use eliminated letters"},
+		{"yellow in a new spot", "BETTER", []string{"TRENDS"}, "BETTER", ""},
+		{"yellow reused in the same spot", "BETTER", []string{"TRENDS"}, "TEETER", "Try revealed letters in a new spot"},
+		{"yellow dropped", "BETTER", []string{"TRENDS"}, "BETTEE", "Guess must use all revealed letters"},
+		// TEETER's second E is grey, but E is green elsewhere so it isn't eliminated
+		{"grey duplicate of a green letter", "BETTER", []string{"TEETER"}, "BETTER", ""},
+		{"grey duplicates of a green letter", "ANSWER", []string{"EERIES"}, "ANSWER", ""},
+		{"hints from every previous guess", "BETTER", []string{"TRENDS", "LETTER"}, "SETTER", "Cannot use eliminated letters"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkHardMode(tt.guess, tt.previous, tt.answer)
+			got := ""
+			if err != nil {
+				got = err.Error()
+			}
+			if got != tt.want {
+				t.Errorf("checkHardMode(%q, %q, %q) = %q, want %q", tt.guess, tt.previous, tt.answer, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHardModeCompliant(t *testing.T) {
+	tests := []struct {
+		guesses []string
+		want    bool
+	}{
+		{nil, true},
+		{[]string{"TRENDS"}, true},
+		{[]string{"LETTER", "SETTER", "BETTER"}, true},
+		{[]string{"TEETER", "BETTER"}, true},
+		{[]string{"TRENDS", "TEETER"}, false},
+		{[]string{"LETTER", "SETTER", "LETTER"}, false},
+	}
+	for _, tt := range tests {
+		if got := hardModeCompliant(tt.guesses, "BETTER"); got != tt.want {
+			t.Errorf("hardModeCompliant(%q) = %v, want %v", tt.guesses, got, tt.want)
+		}
+	}
+}
+
+// TestEnableHardModeMidGame turns hard mode on partway through: allowed only
+// if the guesses so far would have passed.
+func TestEnableHardModeMidGame(t *testing.T) {
+	puzzle := &Puzzle{answer: "BETTER"}
+	tests := []struct {
+		name     string
+		previous []string
+		guess    string
+		wantErr  string
+	}{
+		{"earlier guesses comply", []string{"LETTER"}, "SETTER", ""},
+		{"earlier guesses broke the rules", []string{"TRENDS", "TEETER"}, "BETTER", "Can't enable — previous guesses don't meet hard mode rules"},
+		{"new guess breaks the rules", []string{"LETTER"}, "BATTER", "Correct letters must remain in place"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guesses, outcome, err := playGuess(puzzle, tt.previous, tt.guess, true)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("playGuess error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(guesses) != len(tt.previous)+1 || !outcome.HardModeValid {
+				t.Errorf("playGuess = %q, %+v", guesses, outcome)
+			}
+		})
+	}
+}
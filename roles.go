@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Staff roles, stored in users.role. Each role can do everything the ones
+// below it can: moderators list and ban players, admins also manage roles,
+// backups and account merges.
+const (
+	roleModerator = "moderator"
+	roleAdmin     = "admin"
+)
+
+var roleRank = map[string]int{"": 0, roleModerator: 1, roleAdmin: 2}
+
+func hasRole(u *User, role string) bool {
+	return roleRank[u.Role] >= roleRank[role]
+}
+
+type contextKey string
+
+const userContextKey contextKey = "user"
+
+// requireRole wraps an /api/admin handler so only signed-in, unbanned staff
+// with at least the given role reach it. The handler gets the user back from
+// getUserFromRequest without another lookup.
+func requireRole(role string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := getUserFromRequest(r)
+		if user == nil {
+			http.Error(w, "Not authenticated", http.StatusUnauthorized)
+			return
+		}
+		if user.Banned || !hasRole(user, role) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		h(w, r.WithContext(context.WithValue(r.Context(), userContextKey, user)))
+	}
+}
+
+// bootstrapAdmins lists identities, as "provider:provider_id", that are
+// always admins (BOOTSTRAP_ADMINS, comma-separated). It's how the first
+// admin is made; later ones can be granted from the API.
+var bootstrapAdmins = map[string]bool{}
+
+func init() {
+	for _, identity := range strings.Split(os.Getenv("BOOTSTRAP_ADMINS"), ",") {
+		if identity = strings.TrimSpace(identity); identity != "" {
+			bootstrapAdmins[identity] = true
+		}
+	}
+}
+
+// grantBootstrapAdmins makes the configured identities' users admins, for
+// those that have signed in already. Others are promoted on sign-in.
+func grantBootstrapAdmins() error {
+	for identity := range bootstrapAdmins {
+		provider, providerID, _ := strings.Cut(identity, ":")
+		_, err := db.Exec(`
+			UPDATE users SET role = ?
+			WHERE id = (SELECT user_id FROM identities WHERE provider = ? AND provider_id = ?)
+		`, roleAdmin, provider, providerID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleListStaff lists users holding a role.
+func handleListStaff(w http.ResponseWriter, r *http.Request) {
+	rows, err := db.Query(`
+		SELECT id, COALESCE(custom_name, display_name), role FROM users
+		WHERE role != '' AND deleted_at IS NULL
+		ORDER BY id
+	`)
+	if err != nil {
+		log.Printf("GET /api/admin/roles: %v", err)
+		http.Error(w, "Failed to query roles", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	staff := []map[string]interface{}{}
+	for rows.Next() {
+		var id int64
+		var name, role string
+		if err := rows.Scan(&id, &name, &role); err != nil {
+			log.Printf("GET /api/admin/roles: %v", err)
+			http.Error(w, "Failed to query roles", http.StatusInternalServerError)
+			return
+		}
+		staff = append(staff, map[string]interface{}{"user_id": id, "display_name": name, "role": role})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"staff": staff})
+}
+
+// handleGrantRole gives a user a role, replacing any they had.
+func handleGrantRole(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		UserID int64  `json:"user_id"`
+		Role   string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if body.Role != roleModerator && body.Role != roleAdmin {
+		http.Error(w, "Role must be moderator or admin", http.StatusBadRequest)
+		return
+	}
+	setRole(w, r, body.UserID, body.Role)
+}
+
+// handleRevokeRole takes a user's role away.
+func handleRevokeRole(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		UserID int64 `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	setRole(w, r, body.UserID, "")
+}
+
+func setRole(w http.ResponseWriter, r *http.Request, userID int64, role string) {
+	admin := getUserFromRequest(r)
+	if userID == admin.ID {
+		// Stops the last admin locking everyone out
+		http.Error(w, "Cannot change your own role", http.StatusBadRequest)
+		return
+	}
+	target, err := store.GetUser(userID)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	if err := store.SetRole(userID, role); err != nil {
+		log.Printf("%s %s: user %d: %v", r.Method, r.URL.Path, userID, err)
+		http.Error(w, "Failed to update role", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("Admin %d changed user %d's role from %q to %q", admin.ID, userID, target.Role, role)
+	action := "role.grant"
+	if role == "" {
+		action = "role.revoke"
+	}
+	audit(r, admin.ID, action, userID, map[string]interface{}{"role": target.Role}, map[string]interface{}{"role": role})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"ok":true}`))
+}
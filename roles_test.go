@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestRequireRole runs staff requests through the handlers as main wires
+// them up.
+func TestRequireRole(t *testing.T) {
+	useTestDB(t)
+	if err := loadSigningKeys(); err != nil {
+		t.Fatal(err)
+	}
+
+	users := map[string]*User{}
+	for i, name := range []string{"admin", "moderator", "player", "banned"} {
+		u, err := store.UpsertUser("github", fmt.Sprint(i+1), name, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		users[name] = u
+	}
+	for name, role := range map[string]string{"admin": roleAdmin, "moderator": roleModerator, "banned": roleAdmin} {
+		if err := store.SetRole(users[name].ID, role); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.Exec("UPDATE users SET banned = TRUE WHERE id = ?", users["banned"].ID); err != nil {
+		t.Fatal(err)
+	}
+	cookies := map[string]*http.Cookie{}
+	for name, u := range users {
+		cookies[name] = signIn(t, u.ID)
+	}
+
+	routes := map[string]http.HandlerFunc{
+		"GET /api/admin/users":         requireRole(roleModerator, handleListUsers),
+		"GET /api/admin/audit":         requireRole(roleAdmin, handleListAudit),
+		"GET /api/admin/roles":         requireRole(roleAdmin, handleListStaff),
+		"POST /api/admin/roles/grant":  requireRole(roleAdmin, handleGrantRole),
+		"POST /api/admin/roles/revoke": requireRole(roleAdmin, handleRevokeRole),
+	}
+	do := func(as, route, body string) int {
+		method, path, _ := strings.Cut(route, " ")
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		if as != "" {
+			r.AddCookie(cookies[as])
+		}
+		w := httptest.NewRecorder()
+		routes[route](w, r)
+		return w.Code
+	}
+	grant := func(userID int64, role string) string {
+		return fmt.Sprintf(`{"user_id":%d,"role":%q}`, userID, role)
+	}
+
+	tests := []struct {
+		name, as, route, body string
+		want                  int
+	}{
+		{"signed out", "", "GET /api/admin/users", "", http.StatusUnauthorized},
+		{"player on moderator route", "player", "GET /api/admin/users", "", http.StatusForbidden},
+		{"moderator on moderator route", "moderator", "GET /api/admin/users", "", http.StatusOK},
+		{"moderator lists audit", "moderator", "GET /api/admin/audit", "", http.StatusForbidden},
+		{"moderator lists staff", "moderator", "GET /api/admin/roles", "", http.StatusForbidden},
+		{"moderator grants", "moderator", "POST /api/admin/roles/grant", grant(users["player"].ID, roleModerator), http.StatusForbidden},
+		{"moderator promotes self", "moderator", "POST /api/admin/roles/grant", grant(users["moderator"].ID, roleAdmin), http.StatusForbidden},
+		{"moderator revokes", "moderator", "POST /api/admin/roles/revoke", fmt.Sprintf(`{"user_id":%d}`, users["admin"].ID), http.StatusForbidden},
+		{"banned admin", "banned", "GET /api/admin/roles", "", http.StatusForbidden},
+		{"admin changes own role", "admin", "POST /api/admin/roles/grant", grant(users["admin"].ID, roleModerator), http.StatusBadRequest},
+		{"admin revokes own role", "admin", "POST /api/admin/roles/revoke", fmt.Sprintf(`{"user_id":%d}`, users["admin"].ID), http.StatusBadRequest},
+		{"admin lists staff", "admin", "GET /api/admin/roles", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		if got := do(tt.as, tt.route, tt.body); got != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	// None of the refused requests changed a role
+	for name, want := range map[string]string{"admin": roleAdmin, "moderator": roleModerator, "player": ""} {
+		if u, err := store.GetUser(users[name].ID); err != nil || u.Role != want {
+			t.Errorf("%s's role = %+v, %v, want %q", name, u, err, want)
+		}
+	}
+
+	if got := do("admin", "POST /api/admin/roles/grant", grant(users["player"].ID, roleModerator)); got != http.StatusOK {
+		t.Fatalf("admin grants: status %d, want 200", got)
+	}
+	if u, err := store.GetUser(users["player"].ID); err != nil || u.Role != roleModerator {
+		t.Errorf("player's role after grant = %+v, %v", u, err)
+	}
+}
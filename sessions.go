@@ -0,0 +1,215 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Every session JWT carries a jti naming its row in sessions. A token whose
+// row is gone no longer signs anyone in, so deleting rows is how sessions are
+// revoked: on logout, from the sessions list, and when a user is banned.
+const sessionTTL = 30 * 24 * time.Hour
+
+// lastSeenInterval limits how often a session's last_seen_at is written.
+const lastSeenInterval = 5 * time.Minute
+
+// Session is a signed-in device as shown to its owner.
+type Session struct {
+	ID         string `json:"id"`
+	UserAgent  string `json:"user_agent"`
+	CreatedAt  string `json:"created_at"`
+	LastSeenAt string `json:"last_seen_at"`
+	Current    bool   `json:"current"`
+}
+
+// startSession records a new session for the user and sets its cookie.
+func startSession(w http.ResponseWriter, r *http.Request, userID int64) error {
+	key, err := currentSigningKey()
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	expires := now.Add(sessionTTL)
+	jti := randomToken(16)
+
+	// Expired sessions are cleared out whenever the user signs in again
+	if _, err := db.Exec("DELETE FROM sessions WHERE user_id = ? AND expires_at < ?", userID, now.Format(time.RFC3339)); err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		INSERT INTO sessions (id, user_id, user_agent, created_at, last_seen_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, jti, userID, truncate(r.UserAgent(), 256), now.Format(time.RFC3339), now.Format(time.RFC3339), expires.Format(time.RFC3339))
+	if err != nil {
+		return err
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": userID,
+		"jti": jti,
+		"exp": expires.Unix(),
+	})
+	token.Header["kid"] = key.ID
+	tokenString, err := token.SignedString(key.Secret)
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session",
+		Value:    tokenString,
+		Path:     "/",
+		MaxAge:   int(sessionTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   cookieSecure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// checkSession reports whether the session is still live for the user,
+// bumping its last_seen_at.
+func checkSession(jti string, userID int64) bool {
+	var owner int64
+	var lastSeen string
+	err := db.QueryRow("SELECT user_id, last_seen_at FROM sessions WHERE id = ?", jti).Scan(&owner, &lastSeen)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Session: lookup failed: %v", err)
+		}
+		return false
+	}
+	if owner != userID {
+		return false
+	}
+
+	now := time.Now().UTC()
+	if t, err := time.Parse(time.RFC3339, lastSeen); err != nil || now.Sub(t) > lastSeenInterval {
+		db.Exec("UPDATE sessions SET last_seen_at = ? WHERE id = ?", now.Format(time.RFC3339), jti)
+	}
+	return true
+}
+
+// revokeSession ends one of a user's sessions.
+func revokeSession(jti string, userID int64) error {
+	_, err := db.Exec("DELETE FROM sessions WHERE id = ? AND user_id = ?", jti, userID)
+	return err
+}
+
+// revokeUserSessions signs a user out everywhere.
+func revokeUserSessions(userID int64) error {
+	_, err := db.Exec("DELETE FROM sessions WHERE user_id = ?", userID)
+	return err
+}
+
+func clearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   cookieSecure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// handleListSessions lists the caller's signed-in devices, newest activity
+// first.
+func handleListSessions(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromRequest(r)
+	if user == nil {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+	_, current, _ := sessionClaims(r)
+
+	rows, err := db.Query(`
+		SELECT id, user_agent, created_at, last_seen_at FROM sessions
+		WHERE user_id = ? AND expires_at > ?
+		ORDER BY last_seen_at DESC
+	`, user.ID, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		log.Printf("GET /api/me/sessions: user %d: %v", user.ID, err)
+		http.Error(w, "Failed to load sessions", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		var s Session
+		if err := rows.Scan(&s.ID, &s.UserAgent, &s.CreatedAt, &s.LastSeenAt); err != nil {
+			log.Printf("GET /api/me/sessions: user %d: %v", user.ID, err)
+			http.Error(w, "Failed to load sessions", http.StatusInternalServerError)
+			return
+		}
+		s.Current = s.ID == current
+		sessions = append(sessions, s)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"sessions": sessions})
+}
+
+// handleRevokeSession signs out one of the caller's sessions.
+func handleRevokeSession(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromRequest(r)
+	if user == nil {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	id := r.PathValue("id")
+	result, err := db.Exec("DELETE FROM sessions WHERE id = ? AND user_id = ?", id, user.ID)
+	if err != nil {
+		log.Printf("DELETE /api/me/sessions/%s: user %d: %v", id, user.ID, err)
+		http.Error(w, "Failed to revoke session", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if _, current, _ := sessionClaims(r); current == id {
+		clearSessionCookie(w)
+	}
+	audit(r, user.ID, "session.revoke", user.ID, map[string]interface{}{"session_id": id}, nil)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"ok":true}`))
+}
+
+// handleRevokeAllSessions logs the caller out everywhere, this device
+// included.
+func handleRevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromRequest(r)
+	if user == nil {
+		http.Error(w, "Not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	if err := revokeUserSessions(user.ID); err != nil {
+		log.Printf("DELETE /api/me/sessions: user %d: %v", user.ID, err)
+		http.Error(w, "Failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("User %d logged out everywhere", user.ID)
+	audit(r, user.ID, "sessions.revoke_all", user.ID, nil, nil)
+	clearSessionCookie(w)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"ok":true}`))
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return strings.ToValidUTF8(s[:n], "")
+	}
+	return s
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Session JWTs are signed with HS256 keys kept in signing_keys, so sessions
+// survive restarts and every instance sharing the database agrees on them.
+// Tokens name their key in the kid header. The newest unretired key signs;
+// rotating retires the old one, which keeps verifying until the last token
+// it signed has expired. Each instance rereads the table every minute, and
+// straight away on an unknown kid, to pick up rotations made elsewhere.
+type signingKey struct {
+	ID        string
+	Secret    []byte
+	CreatedAt time.Time
+	RetiredAt *time.Time
+}
+
+var keyring struct {
+	sync.Mutex
+	keys     map[string]*signingKey
+	current  *signingKey
+	loadedAt time.Time
+}
+
+// legacyJWTSecret verifies tokens from before signing keys were stored,
+// which have no kid. It's only set if JWT_SECRET still is, and can be
+// dropped once those tokens have expired.
+var legacyJWTSecret []byte
+
+func init() {
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		legacyJWTSecret = []byte(secret)
+	}
+}
+
+// loadSigningKeys reads the usable keys, creating the first one if there
+// isn't a current key.
+func loadSigningKeys() error {
+	keyring.Lock()
+	defer keyring.Unlock()
+	return loadSigningKeysLocked()
+}
+
+func loadSigningKeysLocked() error {
+	cutoff := time.Now().UTC().Add(-sessionTTL).Format(time.RFC3339)
+	rows, err := db.Query(`
+		SELECT id, secret, created_at, retired_at FROM signing_keys
+		WHERE retired_at IS NULL OR retired_at > ?
+		ORDER BY created_at
+	`, cutoff)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	keys := map[string]*signingKey{}
+	var current *signingKey
+	for rows.Next() {
+		k, err := scanSigningKey(rows)
+		if err != nil {
+			return err
+		}
+		keys[k.ID] = k
+		if k.RetiredAt == nil {
+			current = k
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if current == nil {
+		if current, err = insertSigningKey(db); err != nil {
+			return err
+		}
+		keys[current.ID] = current
+		log.Printf("Created signing key %s", current.ID)
+	}
+
+	keyring.keys = keys
+	keyring.current = current
+	keyring.loadedAt = time.Now()
+	return nil
+}
+
+func scanSigningKey(rows *sql.Rows) (*signingKey, error) {
+	var k signingKey
+	var secret, createdAt string
+	var retiredAt sql.NullString
+	if err := rows.Scan(&k.ID, &secret, &createdAt, &retiredAt); err != nil {
+		return nil, err
+	}
+	var err error
+	if k.Secret, err = hex.DecodeString(secret); err != nil {
+		return nil, fmt.Errorf("signing key %s: %w", k.ID, err)
+	}
+	k.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+	if retiredAt.Valid {
+		t, _ := time.Parse(time.RFC3339, retiredAt.String)
+		k.RetiredAt = &t
+	}
+	return &k, nil
+}
+
+func insertSigningKey(q querier) (*signingKey, error) {
+	k := &signingKey{
+		ID:        randomToken(8),
+		CreatedAt: time.Now().UTC(),
+	}
+	secret := randomToken(32)
+	k.Secret, _ = hex.DecodeString(secret)
+	_, err := q.Exec(
+		"INSERT INTO signing_keys (id, secret, created_at) VALUES (?, ?, ?)",
+		k.ID, secret, k.CreatedAt.Format(time.RFC3339),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// refreshKeyring reloads the keys if they're older than maxAge.
+func refreshKeyring(maxAge time.Duration) {
+	if time.Since(keyring.loadedAt) < maxAge {
+		return
+	}
+	if err := loadSigningKeysLocked(); err != nil {
+		// Keep using what we have
+		log.Printf("Signing keys: reload failed: %v", err)
+		keyring.loadedAt = time.Now()
+	}
+}
+
+// currentSigningKey returns the key new tokens are signed with.
+func currentSigningKey() (*signingKey, error) {
+	keyring.Lock()
+	defer keyring.Unlock()
+	refreshKeyring(time.Minute)
+	if keyring.current == nil {
+		return nil, fmt.Errorf("no signing key loaded")
+	}
+	return keyring.current, nil
+}
+
+// verificationKey returns the secret for a token's kid.
+func verificationKey(kid string) ([]byte, error) {
+	if kid == "" {
+		if legacyJWTSecret == nil {
+			return nil, fmt.Errorf("token has no kid")
+		}
+		return legacyJWTSecret, nil
+	}
+
+	keyring.Lock()
+	defer keyring.Unlock()
+	refreshKeyring(time.Minute)
+	if _, ok := keyring.keys[kid]; !ok {
+		refreshKeyring(10 * time.Second)
+	}
+	k, ok := keyring.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if k.RetiredAt != nil && time.Since(*k.RetiredAt) > sessionTTL {
+		return nil, fmt.Errorf("signing key %q has expired", kid)
+	}
+	return k.Secret, nil
+}
+
+// rotateSigningKey makes a new current key and retires the others. Keys
+// retired long enough ago that nothing they signed is still valid are
+// deleted.
+func rotateSigningKey() (*signingKey, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	if _, err := tx.Exec("UPDATE signing_keys SET retired_at = ? WHERE retired_at IS NULL", now.Format(time.RFC3339)); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("DELETE FROM signing_keys WHERE retired_at < ?", now.Add(-sessionTTL).Format(time.RFC3339)); err != nil {
+		return nil, err
+	}
+	k, err := insertSigningKey(tx)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// revokeSigningKey deletes a key outright, for a leaked secret: every token
+// it signed stops working at once. The current key can't be revoked without
+// rotating first.
+func revokeSigningKey(kid string) error {
+	result, err := db.Exec("DELETE FROM signing_keys WHERE id = ? AND retired_at IS NOT NULL", kid)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("no retired signing key %q (rotate first to revoke the current key)", kid)
+	}
+	return nil
+}
+
+func printSigningKeys() error {
+	rows, err := db.Query("SELECT id, secret, created_at, retired_at FROM signing_keys ORDER BY created_at")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		k, err := scanSigningKey(rows)
+		if err != nil {
+			return err
+		}
+		status := "current"
+		if k.RetiredAt != nil {
+			status = "retired " + k.RetiredAt.Format(time.RFC3339)
+			if time.Since(*k.RetiredAt) > sessionTTL {
+				status += " (expired)"
+			}
+		}
+		fmt.Printf("%s  created %s  %s\n", k.ID, k.CreatedAt.Format(time.RFC3339), status)
+	}
+	return rows.Err()
+}
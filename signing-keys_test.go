@@ -0,0 +1,141 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// signIn starts a session for the user and returns its cookie.
+func signIn(t *testing.T, userID int64) *http.Cookie {
+	t.Helper()
+	w := httptest.NewRecorder()
+	if err := startSession(w, httptest.NewRequest("GET", "/", nil), userID); err != nil {
+		t.Fatal(err)
+	}
+	return w.Result().Cookies()[0]
+}
+
+// signedIn reports whether a request with the cookie gets the user back.
+func signedIn(cookie *http.Cookie, userID int64) bool {
+	r := httptest.NewRequest("GET", "/api/me", nil)
+	r.AddCookie(cookie)
+	user := getUserFromRequest(r)
+	return user != nil && user.ID == userID
+}
+
+// TestSigningKeyRotation checks that sessions outlive a rotation but not a
+// revocation of the key that signed them. The CLI rotates and revokes from
+// another process, so the server's reload is done by hand after each.
+func TestSigningKeyRotation(t *testing.T) {
+	useTestDB(t)
+	if err := loadSigningKeys(); err != nil {
+		t.Fatal(err)
+	}
+	user, err := store.UpsertUser("github", "1", "Alice", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old := signIn(t, user.ID)
+	oldKey, err := currentSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newKey, err := rotateSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := loadSigningKeys(); err != nil {
+		t.Fatal(err)
+	}
+	if k, _ := currentSigningKey(); k.ID != newKey.ID {
+		t.Fatalf("current key %s after rotation, want %s", k.ID, newKey.ID)
+	}
+	if !signedIn(old, user.ID) {
+		t.Error("session signed with the retired key rejected")
+	}
+	fresh := signIn(t, user.ID)
+	if !signedIn(fresh, user.ID) {
+		t.Error("session signed with the new key rejected")
+	}
+
+	if err := revokeSigningKey(newKey.ID); err == nil {
+		t.Error("revoked the current key without rotating")
+	}
+	if err := revokeSigningKey(oldKey.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadSigningKeys(); err != nil {
+		t.Fatal(err)
+	}
+	if signedIn(old, user.ID) {
+		t.Error("session signed with a revoked key still accepted")
+	}
+	if _, err := verificationKey(oldKey.ID); err == nil {
+		t.Error("verificationKey returned a revoked key")
+	}
+	if !signedIn(fresh, user.ID) {
+		t.Error("revoking the old key signed out a session on the new one")
+	}
+}
+
+// TestLegacyToken checks that a token without a kid verifies against
+// JWT_SECRET and nothing else.
+func TestLegacyToken(t *testing.T) {
+	useTestDB(t)
+	if err := loadSigningKeys(); err != nil {
+		t.Fatal(err)
+	}
+	saved := legacyJWTSecret
+	t.Cleanup(func() { legacyJWTSecret = saved })
+
+	user, err := store.UpsertUser("github", "1", "Alice", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A live session row, so only the signature decides
+	jti := "legacy-session"
+	now := time.Now().UTC()
+	_, err = db.Exec(`
+		INSERT INTO sessions (id, user_id, user_agent, created_at, last_seen_at, expires_at)
+		VALUES (?, ?, '', ?, ?, ?)
+	`, jti, user.ID, now.Format(time.RFC3339), now.Format(time.RFC3339), now.Add(time.Hour).Format(time.RFC3339))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cookie := func(secret []byte) *http.Cookie {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"sub": user.ID, "jti": jti, "exp": now.Add(time.Hour).Unix(),
+		})
+		s, err := token.SignedString(secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &http.Cookie{Name: "session", Value: s}
+	}
+	current, err := currentSigningKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	legacyJWTSecret = nil
+	if _, err := verificationKey(""); err == nil {
+		t.Error("verificationKey accepted a missing kid without JWT_SECRET")
+	}
+	if signedIn(cookie(current.Secret), user.ID) {
+		t.Error("token without a kid accepted with no JWT_SECRET set")
+	}
+
+	legacyJWTSecret = []byte("legacy-secret")
+	if !signedIn(cookie(legacyJWTSecret), user.ID) {
+		t.Error("token signed with JWT_SECRET rejected")
+	}
+	if signedIn(cookie(current.Secret), user.ID) {
+		t.Error("token without a kid verified against a stored key")
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// computeUserStats derives a player's stats from their game_results rows.
+// game_results is the source of truth; user_stats is only a cache of this.
+func computeUserStats(q querier, userID int64) (*UserStats, error) {
+	rows, err := q.Query(`
+		SELECT date, won, COALESCE(guesses, 0), hard_mode FROM game_results
+		WHERE user_id = ?
+		ORDER BY date ASC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	s := &UserStats{Distribution: make([]int, maxGuesses)}
+	var results []dayResult
+	for rows.Next() {
+		var date string
+		var won, hard bool
+		var guesses int
+		if err := rows.Scan(&date, &won, &guesses, &hard); err != nil {
+			return nil, err
+		}
+
+		s.Played++
+		if hard {
+			s.PlayedHard++
+		}
+		if won {
+			s.Won++
+			if hard {
+				s.WonHard++
+			}
+			if guesses >= 1 && guesses <= maxGuesses {
+				s.Distribution[guesses-1]++
+			}
+		}
+		s.LastDate = date
+		results = append(results, dayResult{Date: date, Won: won})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	s.CurrentStreak, s.MaxStreak = computeStreaks(results, playerToday(q, userID, time.Now()))
+	return s, nil
+}
+
+// refreshUserStats recomputes a player's user_stats row, leaving their
+// hard_mode preference untouched.
+func refreshUserStats(q querier, userID int64) error {
+	s, err := computeUserStats(q, userID)
+	if err != nil {
+		return err
+	}
+
+	distributionJSON, _ := json.Marshal(s.Distribution)
+	var lastDate *string
+	if s.LastDate != "" {
+		lastDate = &s.LastDate
+	}
+
+	_, err = q.Exec(`
+		INSERT INTO user_stats (user_id, played, won, played_hard, won_hard, current_streak, max_streak, distribution, last_date)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			played = excluded.played,
+			won = excluded.won,
+			played_hard = excluded.played_hard,
+			won_hard = excluded.won_hard,
+			current_streak = excluded.current_streak,
+			max_streak = excluded.max_streak,
+			distribution = excluded.distribution,
+			last_date = excluded.last_date
+	`, userID, s.Played, s.Won, s.PlayedHard, s.WonHard, s.CurrentStreak, s.MaxStreak, string(distributionJSON), lastDate)
+	return err
+}
+
+// rebuildAllUserStats recomputes user_stats for every player with results,
+// replacing any values previously written by clients.
+func rebuildAllUserStats(q querier) error {
+	rows, err := q.Query("SELECT DISTINCT user_id FROM game_results")
+	if err != nil {
+		return err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		if err := refreshUserStats(q, id); err != nil {
+			return err
+		}
+	}
+	log.Printf("Rebuilt user_stats for %d players", len(ids))
+	return nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// postgresStore shares one PostgreSQL database between any number of app
+// instances. Progress updates lock the row so two instances can't both
+// append a guess to the same game.
+type postgresStore struct {
+	sqlStore
+}
+
+func openPostgres(url string) (*postgresStore, error) {
+	connector, err := pq.NewConnector(url)
+	if err != nil {
+		return nil, err
+	}
+	conn := sql.OpenDB(rebindConnector{connector})
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &postgresStore{sqlStore{db: conn, lockClause: " FOR UPDATE"}}, nil
+}
+
+func (s *postgresStore) Name() string { return "postgres" }
+
+// schemaLockID is an arbitrary key for pg_advisory_lock.
+const schemaLockID = 0x776f7264
+
+// lockSchema holds a session advisory lock on a dedicated connection, so a
+// second instance waits for the first to finish migrating instead of racing
+// it.
+func (s *postgresStore) lockSchema() (func(), error) {
+	ctx := context.Background()
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock(?)", schemaLockID); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return func() {
+		conn.ExecContext(ctx, "SELECT pg_advisory_unlock(?)", schemaLockID)
+		conn.Close()
+	}, nil
+}
+
+// postgresDDL maps the SQLite column types used in the schema to their
+// PostgreSQL equivalents. An "INTEGER PRIMARY KEY," column is SQLite's
+// auto-assigned rowid, which becomes a BIGSERIAL.
+var postgresDDL = strings.NewReplacer(
+	"INTEGER PRIMARY KEY,", "BIGSERIAL PRIMARY KEY,",
+	"INTEGER", "BIGINT",
+	"DATETIME", "TIMESTAMPTZ",
+)
+
+// rebind rewrites `?` placeholders as PostgreSQL's $1, $2, ... skipping any
+// inside string literals.
+func rebind(query string) string {
+	if !strings.Contains(query, "?") {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	inString := false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		if c == '\'' {
+			inString = !inString
+		} else if c == '?' && !inString {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// rebindConnector wraps the pq connector so every query passing through
+// database/sql, including ones written inline in handlers, has its
+// placeholders rebound.
+type rebindConnector struct {
+	*pq.Connector
+}
+
+func (c rebindConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return rebindConn{conn}, nil
+}
+
+// rebindConn forwards the optional driver interfaces database/sql looks for,
+// rebinding the query on the way through.
+type rebindConn struct {
+	driver.Conn
+}
+
+func (c rebindConn) Prepare(query string) (driver.Stmt, error) {
+	return c.Conn.Prepare(rebind(query))
+}
+
+func (c rebindConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return p.PrepareContext(ctx, rebind(query))
+	}
+	return c.Prepare(query)
+}
+
+func (c rebindConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if q, ok := c.Conn.(driver.QueryerContext); ok {
+		return q.QueryContext(ctx, rebind(query), args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c rebindConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if e, ok := c.Conn.(driver.ExecerContext); ok {
+		return e.ExecContext(ctx, rebind(query), args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c rebindConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c rebindConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c rebindConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c rebindConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteStore keeps everything in a single SQLite file. It is the default
+// and only suits a single app instance.
+type sqliteStore struct {
+	sqlStore
+}
+
+func openSQLite(dbPath string) (*sqliteStore, error) {
+	// Ensure directory exists
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		return nil, err
+	}
+
+	conn, err := sql.Open("sqlite3", dbPath+"?_journal_mode=WAL&_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteStore{sqlStore{db: conn}}, nil
+}
+
+func (s *sqliteStore) Name() string { return "sqlite" }
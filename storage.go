@@ -0,0 +1,702 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Storage is the persistence layer for players and their games: users,
+// results, progress, stats and timezone events. SQLite is used by default;
+// setting DATABASE_URL to a postgres:// URL switches to PostgreSQL so several
+// app instances can share one database.
+//
+// Features layered on top (leaderboards, groups, friends, cheat flags) query
+// db directly with SQL both backends accept: `?` placeholders, ON CONFLICT
+// and RETURNING.
+type Storage interface {
+	Name() string
+	DB() *sql.DB
+
+	// lockSchema serializes schema setup between instances starting at once.
+	lockSchema() (unlock func(), err error)
+
+	// Users. UpsertUser signs in through an identity, creating the user on
+	// first sign-in.
+	UpsertUser(provider, providerID, displayName, avatarURL string) (*User, error)
+	GetUser(id int64) (*User, error)
+	ListUsers(f UserFilter) (users []UserSummary, total int, err error)
+	SetBanned(userID int64, banned bool) error
+	SetCustomName(userID int64, name string) error
+	ClearCustomName(userID int64) error
+	SetRole(userID int64, role string) error
+
+	// ExportUser returns every row held about a user, table by table.
+	// DeleteUser removes, in one transaction, their group memberships,
+	// friendships, results, progress, stats, timezone events and cheat flags,
+	// scrubs them from the audit log and anonymises the users row; the row
+	// is kept so its ID is never reused and old sessions can't resolve to
+	// another player.
+	ExportUser(userID int64) ([]ExportTable, error)
+	DeleteUser(userID int64) error
+
+	// Identities are the OAuth accounts a user can sign in with, at most one
+	// per provider. LinkIdentity returns errIdentityTaken if the account
+	// belongs to another user; UnlinkIdentity refuses to remove the last one.
+	ListIdentities(userID int64) ([]Identity, error)
+	LinkIdentity(userID int64, provider, providerID, displayName, avatarURL string) error
+	UnlinkIdentity(userID int64, provider string) error
+
+	// Results. InsertResult reports false if the day was already recorded
+	// or has been voided. VoidResult deletes a result and stops it being
+	// recorded again, returning sql.ErrNoRows if there was none.
+	InsertResult(userID int64, date string, won bool, guesses *int, hardMode bool) (bool, error)
+	VoidResult(userID int64, date string) (*GameResult, error)
+
+	// Progress. GetProgress returns sql.ErrNoRows for a game not started.
+	// UpdateProgress loads a game (empty if not started), lets fn change it
+	// and saves it in one transaction; if fn returns an error nothing is
+	// saved and that error is returned.
+	GetProgress(userID int64, date string) (*GameProgress, error)
+	SaveProgress(userID int64, date string, p *GameProgress) error
+	UpdateProgress(userID int64, date string, fn func(p *GameProgress) error) error
+
+	// Stats. The counters are written by refreshUserStats; clients can only
+	// change the hard mode preference.
+	GetUserStats(userID int64) (*UserStats, error)
+	SetHardModePreference(userID int64, hardMode bool) error
+
+	// Timezone events. PreviousTzEvent returns the event before the latest
+	// one, or sql.ErrNoRows.
+	InsertTzEvent(e *TzEvent) error
+	PreviousTzEvent(userID int64) (*TzEvent, error)
+}
+
+var store Storage
+
+// openStorage picks the backend from the environment.
+func openStorage() (Storage, error) {
+	if url := os.Getenv("DATABASE_URL"); strings.HasPrefix(url, "postgres://") || strings.HasPrefix(url, "postgresql://") {
+		return openPostgres(url)
+	}
+	dbPath := os.Getenv("DB_PATH")
+	if dbPath == "" {
+		dbPath = "/data/wordle-six.db"
+	}
+	return openSQLite(dbPath)
+}
+
+// ddl adapts a CREATE/ALTER statement written for SQLite to the active
+// backend, so the schema and migrations are only written once.
+func ddl(stmt string) string {
+	if store != nil && store.Name() == "postgres" {
+		return postgresDDL.Replace(stmt)
+	}
+	return stmt
+}
+
+// UserSummary is a row in the admin user list.
+type UserSummary struct {
+	ID          int64  `json:"id"`
+	Provider    string `json:"provider"`
+	DisplayName string `json:"display_name"`
+	CustomName  string `json:"custom_name,omitempty"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+	Banned      bool   `json:"banned"`
+	Role        string `json:"role,omitempty"`
+	CreatedAt   string `json:"created_at,omitempty"`
+	DeletedAt   string `json:"deleted_at,omitempty"`
+	GamesPlayed int    `json:"games_played"`
+}
+
+// UserFilter selects a page of the admin user list. Query matches a user ID,
+// part of a display or custom name, or an exact provider account ID;
+// Provider keeps users with an identity from that provider. Sort is "id",
+// "joined" or "games".
+type UserFilter struct {
+	Query    string
+	Provider string
+	Banned   *bool
+	Sort     string
+	Desc     bool
+	Limit    int
+	Offset   int
+}
+
+// userSortColumns maps UserFilter.Sort to ORDER BY columns.
+var userSortColumns = map[string]string{
+	"id":     "u.id",
+	"joined": "u.created_at",
+	"games":  "games_played",
+}
+
+var (
+	errIdentityTaken  = errors.New("that account is linked to another player")
+	errProviderLinked = errors.New("a different account from that provider is already linked")
+	errLastIdentity   = errors.New("can't unlink the only sign-in method")
+)
+
+// Identity is an OAuth account linked to a user.
+type Identity struct {
+	Provider    string `json:"provider"`
+	DisplayName string `json:"display_name"`
+	AvatarURL   string `json:"avatar_url,omitempty"`
+	LinkedAt    string `json:"linked_at"`
+}
+
+// GameResult is a finished game as recorded in game_results.
+type GameResult struct {
+	Date     string `json:"date"`
+	Won      bool   `json:"won"`
+	Guesses  *int   `json:"guesses"`
+	HardMode bool   `json:"hard_mode"`
+}
+
+// ExportTable is one table's rows in a personal data export.
+type ExportTable struct {
+	Name    string
+	Columns []string
+	Rows    [][]interface{}
+}
+
+// TzEvent is a client-reported clock reading, kept for cheat detection.
+type TzEvent struct {
+	UserID     int64
+	ServerUTC  time.Time
+	ClientTime string
+	TzOffset   int
+	IP         string
+	Endpoint   string
+}
+
+// sqlStore implements Storage over database/sql. The SQL is shared by both
+// backends; lockClause is appended to the SELECT in UpdateProgress.
+type sqlStore struct {
+	db         *sql.DB
+	lockClause string
+}
+
+func (s *sqlStore) DB() *sql.DB { return s.db }
+
+func (s *sqlStore) lockSchema() (func(), error) { return func() {}, nil }
+
+func (s *sqlStore) UpsertUser(provider, providerID, displayName, avatarURL string) (*User, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRow(
+		"SELECT user_id FROM identities WHERE provider = ? AND provider_id = ?",
+		provider, providerID,
+	).Scan(&id)
+	if err == sql.ErrNoRows {
+		err = tx.QueryRow(`
+			INSERT INTO users (provider, provider_id, display_name, avatar_url)
+			VALUES (?, ?, ?, ?)
+			RETURNING id
+		`, provider, providerID, displayName, avatarURL).Scan(&id)
+		if err == nil {
+			_, err = tx.Exec(`
+				INSERT INTO identities (user_id, provider, provider_id, display_name, avatar_url)
+				VALUES (?, ?, ?, ?, ?)
+			`, id, provider, providerID, displayName, avatarURL)
+		}
+	} else if err == nil {
+		// The provider profile last signed in with is the account's fallback
+		// name and avatar
+		_, err = tx.Exec(
+			"UPDATE identities SET display_name = ?, avatar_url = ? WHERE provider = ? AND provider_id = ?",
+			displayName, avatarURL, provider, providerID,
+		)
+		if err == nil {
+			_, err = tx.Exec("UPDATE users SET display_name = ?, avatar_url = ? WHERE id = ?", displayName, avatarURL, id)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return s.GetUser(id)
+}
+
+func (s *sqlStore) GetUser(id int64) (*User, error) {
+	u := &User{}
+	var customName *string
+	err := s.db.QueryRow("SELECT id, provider, provider_id, display_name, custom_name, COALESCE(avatar_url, ''), banned, role FROM users WHERE id = ? AND deleted_at IS NULL", id).
+		Scan(&u.ID, &u.Provider, &u.ProviderID, &u.DisplayName, &customName, &u.AvatarURL, &u.Banned, &u.Role)
+	if err != nil {
+		return nil, err
+	}
+	u.CustomName = customName
+	u.IsNew = customName == nil
+	return u, nil
+}
+
+func (s *sqlStore) ListUsers(f UserFilter) ([]UserSummary, int, error) {
+	conds := []string{}
+	args := []interface{}{}
+	if f.Query != "" {
+		pattern := "%" + likeEscaper.Replace(strings.ToLower(f.Query)) + "%"
+		cond := `LOWER(COALESCE(u.custom_name, '')) LIKE ? ESCAPE '\'
+			OR LOWER(u.display_name) LIKE ? ESCAPE '\'
+			OR EXISTS (SELECT 1 FROM identities i WHERE i.user_id = u.id AND i.provider_id = ?)`
+		args = append(args, pattern, pattern, f.Query)
+		if id, err := strconv.ParseInt(f.Query, 10, 64); err == nil {
+			cond += " OR u.id = ?"
+			args = append(args, id)
+		}
+		conds = append(conds, "("+cond+")")
+	}
+	if f.Provider != "" {
+		conds = append(conds, "EXISTS (SELECT 1 FROM identities i WHERE i.user_id = u.id AND i.provider = ?)")
+		args = append(args, f.Provider)
+	}
+	if f.Banned != nil {
+		conds = append(conds, "u.banned = ?")
+		args = append(args, *f.Banned)
+	}
+	where := ""
+	if len(conds) > 0 {
+		where = "WHERE " + strings.Join(conds, " AND ")
+	}
+
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM users u "+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	order := userSortColumns[f.Sort]
+	if order == "" {
+		order = "u.id"
+	}
+	if f.Desc {
+		order += " DESC"
+	}
+	rows, err := s.db.Query(`
+		SELECT u.id, u.provider, u.display_name, COALESCE(u.custom_name, ''), COALESCE(u.avatar_url, ''),
+			u.banned, u.role, u.created_at, u.deleted_at, COALESCE(st.played, 0) AS games_played
+		FROM users u
+		LEFT JOIN user_stats st ON st.user_id = u.id
+		`+where+`
+		ORDER BY `+order+`, u.id
+		LIMIT ? OFFSET ?
+	`, append(args, f.Limit, f.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	users := []UserSummary{}
+	for rows.Next() {
+		var u UserSummary
+		var createdAt, deletedAt sql.NullString
+		if err := rows.Scan(&u.ID, &u.Provider, &u.DisplayName, &u.CustomName, &u.AvatarURL, &u.Banned, &u.Role, &createdAt, &deletedAt, &u.GamesPlayed); err != nil {
+			return nil, 0, err
+		}
+		u.CreatedAt, u.DeletedAt = createdAt.String, deletedAt.String
+		users = append(users, u)
+	}
+	return users, total, rows.Err()
+}
+
+// likeEscaper escapes LIKE wildcards in user input, for use with ESCAPE '\'.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+func (s *sqlStore) SetBanned(userID int64, banned bool) error {
+	_, err := s.db.Exec("UPDATE users SET banned = ? WHERE id = ?", banned, userID)
+	return err
+}
+
+func (s *sqlStore) SetCustomName(userID int64, name string) error {
+	_, err := s.db.Exec("UPDATE users SET custom_name = ? WHERE id = ?", name, userID)
+	return err
+}
+
+func (s *sqlStore) ClearCustomName(userID int64) error {
+	_, err := s.db.Exec("UPDATE users SET custom_name = NULL WHERE id = ?", userID)
+	return err
+}
+
+func (s *sqlStore) SetRole(userID int64, role string) error {
+	_, err := s.db.Exec("UPDATE users SET role = ? WHERE id = ?", role, userID)
+	return err
+}
+
+// exportQueries select a user's rows from each table in an export.
+var exportQueries = []struct{ table, query string }{
+	{"users", "SELECT * FROM users WHERE id = ?"},
+	{"identities", "SELECT * FROM identities WHERE user_id = ? ORDER BY id"},
+	{"sessions", "SELECT user_agent, created_at, last_seen_at, expires_at FROM sessions WHERE user_id = ? ORDER BY created_at"},
+	{"game_results", "SELECT * FROM game_results WHERE user_id = ? ORDER BY date"},
+	{"game_progress", "SELECT * FROM game_progress WHERE user_id = ? ORDER BY date"},
+	{"user_stats", "SELECT * FROM user_stats WHERE user_id = ?"},
+	{"tz_events", "SELECT * FROM tz_events WHERE user_id = ? ORDER BY id"},
+	{"voided_results", "SELECT * FROM voided_results WHERE user_id = ? ORDER BY date"},
+}
+
+func (s *sqlStore) ExportUser(userID int64) ([]ExportTable, error) {
+	var tables []ExportTable
+	for _, eq := range exportQueries {
+		t, err := s.exportTable(eq.table, eq.query, userID)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, *t)
+	}
+	return tables, nil
+}
+
+func (s *sqlStore) exportTable(name, query string, userID int64) (*ExportTable, error) {
+	rows, err := s.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	t := &ExportTable{Name: name, Rows: [][]interface{}{}}
+	if t.Columns, err = rows.Columns(); err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		vals := make([]interface{}, len(t.Columns))
+		ptrs := make([]interface{}, len(vals))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+		// Drivers return text as []byte and timestamps as time.Time
+		for i, v := range vals {
+			switch v := v.(type) {
+			case []byte:
+				vals[i] = string(v)
+			case time.Time:
+				vals[i] = v.UTC().Format(time.RFC3339)
+			}
+		}
+		t.Rows = append(t.Rows, vals)
+	}
+	return t, rows.Err()
+}
+
+func (s *sqlStore) DeleteUser(userID int64) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	groupIDs, err := userGroupIDs(tx, userID)
+	if err != nil {
+		return err
+	}
+	for _, groupID := range groupIDs {
+		if err := leaveGroup(tx, groupID, userID); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM friendships WHERE requester_id = ? OR addressee_id = ?", userID, userID); err != nil {
+		return err
+	}
+	for _, table := range []string{"identities", "sessions", "game_results", "leaderboard_daily", "game_progress", "user_stats", "tz_events", "voided_results", "cheat_flags"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE user_id = ?", userID); err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(`
+		UPDATE users SET
+			provider = 'deleted',
+			provider_id = ?,
+			display_name = 'Deleted player',
+			custom_name = NULL,
+			avatar_url = NULL,
+			deleted_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, strconv.FormatInt(userID, 10), userID)
+	if err == nil {
+		err = scrubAudit(tx, userID)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) ListIdentities(userID int64) ([]Identity, error) {
+	rows, err := s.db.Query(`
+		SELECT provider, display_name, COALESCE(avatar_url, ''), created_at
+		FROM identities WHERE user_id = ?
+		ORDER BY created_at, id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []Identity{}
+	for rows.Next() {
+		var i Identity
+		if err := rows.Scan(&i.Provider, &i.DisplayName, &i.AvatarURL, &i.LinkedAt); err != nil {
+			return nil, err
+		}
+		identities = append(identities, i)
+	}
+	return identities, rows.Err()
+}
+
+func (s *sqlStore) LinkIdentity(userID int64, provider, providerID, displayName, avatarURL string) error {
+	var owner int64
+	err := s.db.QueryRow(
+		"SELECT user_id FROM identities WHERE provider = ? AND provider_id = ?",
+		provider, providerID,
+	).Scan(&owner)
+	if err == nil {
+		if owner == userID {
+			return nil
+		}
+		return errIdentityTaken
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	result, err := s.db.Exec(`
+		INSERT INTO identities (user_id, provider, provider_id, display_name, avatar_url)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT DO NOTHING
+	`, userID, provider, providerID, displayName, avatarURL)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errProviderLinked
+	}
+	return nil
+}
+
+func (s *sqlStore) UnlinkIdentity(userID int64, provider string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var count int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM identities WHERE user_id = ?", userID).Scan(&count); err != nil {
+		return err
+	}
+	result, err := tx.Exec("DELETE FROM identities WHERE user_id = ? AND provider = ?", userID, provider)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	if count <= 1 {
+		return errLastIdentity
+	}
+
+	// users keeps the provider the account was created with, which must stay
+	// unique; point it at a remaining identity so the unlinked one can sign
+	// up again later
+	_, err = tx.Exec(`
+		UPDATE users SET (provider, provider_id) = (
+			SELECT provider, provider_id FROM identities
+			WHERE user_id = ? ORDER BY created_at, id LIMIT 1
+		)
+		WHERE id = ?
+	`, userID, userID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) InsertResult(userID int64, date string, won bool, guesses *int, hardMode bool) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var voided bool
+	err = tx.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM voided_results WHERE user_id = ? AND date = ?)",
+		userID, date,
+	).Scan(&voided)
+	if err != nil || voided {
+		return false, err
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO game_results (user_id, date, won, guesses, hard_mode)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(user_id, date) DO NOTHING
+	`, userID, date, won, guesses, hardMode)
+	if err != nil {
+		return false, err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	if _, err := tx.Exec(leaderboardDailySQL+" WHERE user_id = ? AND date = ?", userID, date); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func (s *sqlStore) VoidResult(userID int64, date string) (*GameResult, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	res := &GameResult{Date: date}
+	err = tx.QueryRow(
+		"DELETE FROM game_results WHERE user_id = ? AND date = ? RETURNING won, guesses, hard_mode",
+		userID, date,
+	).Scan(&res.Won, &res.Guesses, &res.HardMode)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("DELETE FROM leaderboard_daily WHERE user_id = ? AND date = ?", userID, date); err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(
+		"INSERT INTO voided_results (user_id, date, voided_at) VALUES (?, ?, ?) ON CONFLICT(user_id, date) DO NOTHING",
+		userID, date, time.Now().UTC().Format(time.RFC3339),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return res, tx.Commit()
+}
+
+func (s *sqlStore) GetProgress(userID int64, date string) (*GameProgress, error) {
+	return scanProgress(s.db.QueryRow(
+		"SELECT guesses, hard_mode, game_over, won FROM game_progress WHERE user_id = ? AND date = ?",
+		userID, date,
+	))
+}
+
+func scanProgress(row *sql.Row) (*GameProgress, error) {
+	var guessesJSON string
+	p := &GameProgress{}
+	if err := row.Scan(&guessesJSON, &p.HardMode, &p.GameOver, &p.Won); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(guessesJSON), &p.Guesses); err != nil || p.Guesses == nil {
+		p.Guesses = []string{}
+	}
+	return p, nil
+}
+
+const upsertProgressSQL = `
+	INSERT INTO game_progress (user_id, date, guesses, hard_mode, game_over, won)
+	VALUES (?, ?, ?, ?, ?, ?)
+	ON CONFLICT(user_id, date) DO UPDATE SET
+		guesses = excluded.guesses,
+		hard_mode = excluded.hard_mode,
+		game_over = excluded.game_over,
+		won = excluded.won
+`
+
+func (s *sqlStore) SaveProgress(userID int64, date string, p *GameProgress) error {
+	guessesJSON, _ := json.Marshal(p.Guesses)
+	_, err := s.db.Exec(upsertProgressSQL, userID, date, string(guessesJSON), p.HardMode, p.GameOver, p.Won)
+	return err
+}
+
+func (s *sqlStore) UpdateProgress(userID int64, date string, fn func(p *GameProgress) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	p, err := scanProgress(tx.QueryRow(
+		"SELECT guesses, hard_mode, game_over, won FROM game_progress WHERE user_id = ? AND date = ?"+s.lockClause,
+		userID, date,
+	))
+	if err == sql.ErrNoRows {
+		p, err = &GameProgress{Guesses: []string{}}, nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := fn(p); err != nil {
+		return err
+	}
+
+	guessesJSON, _ := json.Marshal(p.Guesses)
+	if _, err := tx.Exec(upsertProgressSQL, userID, date, string(guessesJSON), p.HardMode, p.GameOver, p.Won); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStore) GetUserStats(userID int64) (*UserStats, error) {
+	st := &UserStats{}
+	var distributionJSON string
+	var lastDate *string
+	err := s.db.QueryRow(
+		"SELECT played, won, played_hard, won_hard, current_streak, max_streak, distribution, last_date, hard_mode FROM user_stats WHERE user_id = ?",
+		userID,
+	).Scan(&st.Played, &st.Won, &st.PlayedHard, &st.WonHard, &st.CurrentStreak, &st.MaxStreak, &distributionJSON, &lastDate, &st.HardMode)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(distributionJSON), &st.Distribution); err != nil || len(st.Distribution) != maxGuesses {
+		st.Distribution = make([]int, maxGuesses)
+	}
+	if lastDate != nil {
+		st.LastDate = *lastDate
+	}
+	return st, nil
+}
+
+func (s *sqlStore) SetHardModePreference(userID int64, hardMode bool) error {
+	_, err := s.db.Exec(`
+		INSERT INTO user_stats (user_id, hard_mode)
+		VALUES (?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			hard_mode = excluded.hard_mode
+	`, userID, hardMode)
+	return err
+}
+
+func (s *sqlStore) InsertTzEvent(e *TzEvent) error {
+	_, err := s.db.Exec(`
+		INSERT INTO tz_events (user_id, server_utc, client_time, tz_offset, ip, endpoint)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, e.UserID, e.ServerUTC.UTC().Format(time.RFC3339), e.ClientTime, e.TzOffset, e.IP, e.Endpoint)
+	return err
+}
+
+func (s *sqlStore) PreviousTzEvent(userID int64) (*TzEvent, error) {
+	e := &TzEvent{UserID: userID}
+	var serverUTC string
+	err := s.db.QueryRow(`
+		SELECT tz_offset, server_utc, client_time, ip, endpoint FROM tz_events
+		WHERE user_id = ? AND id != (SELECT MAX(id) FROM tz_events WHERE user_id = ?)
+		ORDER BY server_utc DESC LIMIT 1
+	`, userID, userID).Scan(&e.TzOffset, &serverUTC, &e.ClientTime, &e.IP, &e.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if e.ServerUTC, err = time.Parse(time.RFC3339, serverUTC); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useTestDB runs initDB against a fresh SQLite database for one test.
+func useTestDB(t *testing.T) {
+	t.Helper()
+	t.Setenv("DATABASE_URL", "")
+	t.Setenv("DB_PATH", filepath.Join(t.TempDir(), "live.db"))
+	if err := initDB(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	invalidateLeaderboard()
+}
+
+// usePostgresTestDB runs initDB in a throwaway schema of the database named
+// by DATABASE_URL, skipping the test when that isn't a postgres:// URL.
+func usePostgresTestDB(t *testing.T) {
+	t.Helper()
+	url := os.Getenv("DATABASE_URL")
+	if !strings.HasPrefix(url, "postgres://") && !strings.HasPrefix(url, "postgresql://") {
+		t.Skip("DATABASE_URL is not a postgres:// URL")
+	}
+
+	admin, err := openPostgres(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := fmt.Sprintf("wordle_six_test_%d", time.Now().UnixNano())
+	if _, err := admin.db.Exec("CREATE SCHEMA " + schema); err != nil {
+		admin.db.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		admin.db.Exec("DROP SCHEMA " + schema + " CASCADE")
+		admin.db.Close()
+	})
+
+	sep := "?"
+	if strings.Contains(url, "?") {
+		sep = "&"
+	}
+	t.Setenv("DATABASE_URL", url+sep+"search_path="+schema)
+	if err := initDB(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	invalidateLeaderboard()
+}
+
+func TestRebind(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"SELECT 1", "SELECT 1"},
+		{"SELECT * FROM users WHERE id = ?", "SELECT * FROM users WHERE id = $1"},
+		{"INSERT INTO t (a, b, c) VALUES (?, ?, ?)", "INSERT INTO t (a, b, c) VALUES ($1, $2, $3)"},
+		{"SELECT '?' FROM t WHERE a = ?", "SELECT '?' FROM t WHERE a = $1"},
+		{"SELECT 'it''s ?' FROM t WHERE a = ?", "SELECT 'it''s ?' FROM t WHERE a = $1"},
+		{`WHERE name LIKE ? ESCAPE '\' OR other LIKE ? ESCAPE '\'`, `WHERE name LIKE $1 ESCAPE '\' OR other LIKE $2 ESCAPE '\'`},
+		{"SELECT pg_advisory_lock(?)", "SELECT pg_advisory_lock($1)"},
+	}
+	for _, tt := range tests {
+		if got := rebind(tt.in); got != tt.want {
+			t.Errorf("rebind(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestStorageSQLite(t *testing.T) {
+	useTestDB(t)
+	testStorage(t)
+}
+
+func TestStoragePostgres(t *testing.T) {
+	usePostgresTestDB(t)
+	testStorage(t)
+}
+
+// testStorage exercises the Storage methods and the shared SQL layered on
+// them against whichever backend initDB opened.
+func testStorage(t *testing.T) {
+	version, err := schemaVersion(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := migrations[len(migrations)-1].version; version != want {
+		t.Fatalf("schema version %d, want %d", version, want)
+	}
+
+	alice, err := store.UpsertUser("github", "1", "Alice", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !alice.IsNew {
+		t.Error("player without a chosen name not reported as new")
+	}
+	again, err := store.UpsertUser("github", "1", "Alice", "")
+	if err != nil || again.ID != alice.ID {
+		t.Fatalf("second sign-in = %+v, %v", again, err)
+	}
+	bob, err := store.UpsertUser("google", "2", "Bob", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// LIKE wildcards in a search are matched literally
+	if err := store.SetCustomName(bob.ID, "50%_off"); err != nil {
+		t.Fatal(err)
+	}
+	for q, want := range map[string]int{"50%": 1, "5_": 0, "alice": 1} {
+		users, total, err := store.ListUsers(UserFilter{Query: q, Sort: "id", Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != want || len(users) != want {
+			t.Errorf("ListUsers(%q) found %d (total %d), want %d", q, len(users), total, want)
+		}
+	}
+	if err := store.ClearCustomName(bob.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetRole(alice.ID, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if u, err := store.GetUser(bob.ID); err != nil || u.CustomName != nil {
+		t.Errorf("GetUser after ClearCustomName = %+v, %v", u, err)
+	}
+	if u, err := store.GetUser(alice.ID); err != nil || u.Role != "admin" {
+		t.Errorf("GetUser after SetRole = %+v, %v", u, err)
+	}
+
+	if err := store.LinkIdentity(alice.ID, "google", "2", "Bob", ""); err != errIdentityTaken {
+		t.Errorf("linking another player's account: %v, want errIdentityTaken", err)
+	}
+	if err := store.UnlinkIdentity(alice.ID, "github"); err != errLastIdentity {
+		t.Errorf("unlinking the only sign-in: %v, want errLastIdentity", err)
+	}
+
+	three, four := 3, 4
+	for _, r := range []struct {
+		userID   int64
+		date     string
+		won      bool
+		guesses  *int
+		hardMode bool
+	}{
+		{alice.ID, "2024-01-01", true, &three, true},
+		{alice.ID, "2024-01-02", false, nil, false},
+		{bob.ID, "2024-01-01", true, &four, false},
+		{bob.ID, "2024-01-03", true, &four, false},
+	} {
+		if inserted, err := store.InsertResult(r.userID, r.date, r.won, r.guesses, r.hardMode); err != nil || !inserted {
+			t.Fatalf("InsertResult(%d, %s) = %v, %v", r.userID, r.date, inserted, err)
+		}
+	}
+	if inserted, err := store.InsertResult(alice.ID, "2024-01-01", false, nil, false); err != nil || inserted {
+		t.Errorf("second result for a day = %v, %v, want not inserted", inserted, err)
+	}
+	checkLeaderboardDaily(t, "after inserts")
+
+	if err := refreshUserStats(db, alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := store.GetUserStats(alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Played != 2 || stats.Won != 1 || stats.WonHard != 1 || stats.Distribution[2] != 1 || stats.LastDate != "2024-01-02" {
+		t.Errorf("stats = %+v", stats)
+	}
+	if err := store.SetHardModePreference(alice.ID, true); err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := buildLeaderboard(leaderboardWindow{Period: "all"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 2 || all[0].Rank != 1 || all[1].Rank != 2 {
+		t.Errorf("all-time leaderboard = %+v", all)
+	}
+	day, err := buildLeaderboard(leaderboardWindow{Period: "day", From: "2024-01-02", To: "2024-01-02"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(day) != 1 || day[0].UserID != alice.ID || day[0].WinRate != 0 {
+		t.Errorf("2024-01-02 leaderboard = %+v", day)
+	}
+
+	voided, err := store.VoidResult(alice.ID, "2024-01-02")
+	if err != nil || voided.Won {
+		t.Fatalf("VoidResult = %+v, %v", voided, err)
+	}
+	if _, err := store.VoidResult(alice.ID, "2024-01-02"); err != sql.ErrNoRows {
+		t.Errorf("voiding twice: %v, want sql.ErrNoRows", err)
+	}
+	if inserted, err := store.InsertResult(alice.ID, "2024-01-02", true, &three, false); err != nil || inserted {
+		t.Errorf("recording a voided day = %v, %v, want not inserted", inserted, err)
+	}
+	checkLeaderboardDaily(t, "after a void")
+
+	if _, err := store.GetProgress(alice.ID, "2024-01-04"); err != sql.ErrNoRows {
+		t.Errorf("GetProgress for a game not started: %v, want sql.ErrNoRows", err)
+	}
+	if err := store.SaveProgress(alice.ID, "2024-01-04", &GameProgress{Guesses: []string{"LETTER"}}); err != nil {
+		t.Fatal(err)
+	}
+	err = store.UpdateProgress(alice.ID, "2024-01-04", func(p *GameProgress) error {
+		p.Guesses = append(p.Guesses, "BETTER")
+		p.GameOver, p.Won = true, true
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	errKeep := fmt.Errorf("keep it")
+	if err := store.UpdateProgress(alice.ID, "2024-01-04", func(p *GameProgress) error {
+		p.Guesses = nil
+		return errKeep
+	}); err != errKeep {
+		t.Errorf("UpdateProgress returned %v, want fn's error", err)
+	}
+	p, err := store.GetProgress(alice.ID, "2024-01-04")
+	if err != nil || len(p.Guesses) != 2 || !p.Won {
+		t.Errorf("GetProgress = %+v, %v", p, err)
+	}
+
+	first := time.Date(2024, 1, 4, 12, 0, 0, 0, time.UTC)
+	for i, offset := range []int{-60, 300} {
+		err := store.InsertTzEvent(&TzEvent{
+			UserID: alice.ID, ServerUTC: first.Add(time.Duration(i) * time.Minute),
+			ClientTime: first.Format(time.RFC3339), TzOffset: offset, IP: "203.0.113.1", Endpoint: "guess",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	prev, err := store.PreviousTzEvent(alice.ID)
+	if err != nil || prev.TzOffset != -60 || !prev.ServerUTC.Equal(first) {
+		t.Errorf("PreviousTzEvent = %+v, %v", prev, err)
+	}
+
+	// Both played 2024-01-01: Alice's game is kept. Bob's 2024-01-03 moves over.
+	if err := mergeUsers(alice.ID, bob.ID); err != nil {
+		t.Fatal(err)
+	}
+	checkLeaderboardDaily(t, "after a merge")
+	identities, err := store.ListIdentities(alice.ID)
+	if err != nil || len(identities) != 2 {
+		t.Errorf("identities after merge = %+v, %v", identities, err)
+	}
+	if _, err := store.GetUser(bob.ID); err != sql.ErrNoRows {
+		t.Errorf("GetUser of a merged account: %v, want sql.ErrNoRows", err)
+	}
+	var provider string
+	if err := db.QueryRow("SELECT provider FROM users WHERE id = ?", bob.ID).Scan(&provider); err != nil || provider != "merged" {
+		t.Errorf("merged account's provider = %q, %v", provider, err)
+	}
+	stats, err = store.GetUserStats(alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Played != 2 || stats.Won != 2 || stats.WonHard != 1 || !stats.HardMode {
+		t.Errorf("stats after merge = %+v", stats)
+	}
+
+	tables, err := store.ExportUser(alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := map[string]int{}
+	for _, table := range tables {
+		rows[table.Name] = len(table.Rows)
+	}
+	if rows["game_results"] != 2 || rows["tz_events"] != 2 {
+		t.Errorf("export row counts = %v", rows)
+	}
+
+	if err := store.DeleteUser(alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	checkLeaderboardDaily(t, "after a delete")
+	if _, err := store.GetUser(alice.ID); err != sql.ErrNoRows {
+		t.Errorf("GetUser of a deleted account: %v, want sql.ErrNoRows", err)
+	}
+	if identities, err := store.ListIdentities(alice.ID); err != nil || len(identities) != 0 {
+		t.Errorf("identities after delete = %+v, %v", identities, err)
+	}
+}
+
+// checkLeaderboardDaily compares leaderboard_daily with the totals a fresh
+// copy of game_results gives.
+func checkLeaderboardDaily(t *testing.T, when string) {
+	t.Helper()
+	read := func(q querier) []string {
+		rows, err := q.Query("SELECT date, user_id, games, wins, hard_wins, score_tenths, guess_sum FROM leaderboard_daily ORDER BY date, user_id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rows.Close()
+		var got []string
+		for rows.Next() {
+			var date string
+			var userID, games, wins, hardWins, score, guesses int
+			if err := rows.Scan(&date, &userID, &games, &wins, &hardWins, &score, &guesses); err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, fmt.Sprintf("%s %d %d %d %d %d %d", date, userID, games, wins, hardWins, score, guesses))
+		}
+		return got
+	}
+	kept := read(db)
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM leaderboard_daily"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Exec(leaderboardDailySQL); err != nil {
+		t.Fatal(err)
+	}
+	if want := read(tx); fmt.Sprint(kept) != fmt.Sprint(want) {
+		t.Errorf("leaderboard_daily %s = %v, want %v", when, kept, want)
+	}
+}
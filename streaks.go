@@ -0,0 +1,164 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// unknownTzOffset is assumed for players who never reported a timezone: UTC-12,
+// the last place on Earth to reach each new day.
+const unknownTzOffset = 12 * 60
+
+// dayResult is one game_results row reduced to what streaks need.
+type dayResult struct {
+	Date string
+	Won  bool
+}
+
+// computeStreaks returns the current and longest runs of wins on consecutive
+// calendar days. results may be in any order; rows with an invalid date are
+// ignored. A loss or a skipped day ends a run, and the current streak is only
+// alive if the last win was on the player's today or yesterday.
+func computeStreaks(results []dayResult, today string) (current, longest int) {
+	if !sort.SliceIsSorted(results, func(i, j int) bool { return results[i].Date < results[j].Date }) {
+		results = append([]dayResult(nil), results...)
+		sort.Slice(results, func(i, j int) bool { return results[i].Date < results[j].Date })
+	}
+
+	run := 0
+	var prev time.Time
+	for _, r := range results {
+		d, err := time.Parse(dateLayout, r.Date)
+		if err != nil {
+			continue
+		}
+		if !r.Won {
+			run = 0
+		} else if run > 0 && d.Sub(prev) == 24*time.Hour {
+			run++
+		} else {
+			run = 1
+		}
+		if run > longest {
+			longest = run
+		}
+		prev = d
+	}
+
+	if run == 0 {
+		return 0, longest
+	}
+	t, err := time.Parse(dateLayout, today)
+	if err != nil || t.Sub(prev) > 24*time.Hour {
+		return 0, longest
+	}
+	return run, longest
+}
+
+// playerToday returns the puzzle date it currently is for a player, based on
+// the timezone offset they last reported. Without one we assume
+// unknownTzOffset so a streak is never broken before the player's own
+// midnight.
+func playerToday(q querier, userID int64, now time.Time) string {
+	var tzOffset int
+	err := q.QueryRow(latestTzOffsetsSQL+" AND t.user_id = ?", userID).Scan(&userID, &tzOffset)
+	if err != nil {
+		return localPuzzleDate(now, unknownTzOffset)
+	}
+	return localPuzzleDate(now, tzOffset)
+}
+
+// latestTzOffsetsSQL selects each player's latest timezone offset: their
+// newest event by server time, ties broken by id. playerToday and
+// allCurrentStreaks share it so stats and the leaderboard agree on which
+// day is a player's today.
+const latestTzOffsetsSQL = `
+	SELECT t.user_id, t.tz_offset FROM tz_events t
+	WHERE t.id = (
+		SELECT id FROM tz_events WHERE user_id = t.user_id ORDER BY server_utc DESC, id DESC LIMIT 1
+	)`
+
+// localPuzzleDate converts now to a date string for a JS getTimezoneOffset()
+// value (minutes behind UTC, so UTC+10 is -600).
+func localPuzzleDate(now time.Time, tzOffset int) string {
+	return now.UTC().Add(-time.Duration(tzOffset) * time.Minute).Format(dateLayout)
+}
+
+// userStreaks loads a player's results and computes their streaks.
+func userStreaks(userID int64) (current, longest int, err error) {
+	rows, err := db.Query(`
+		SELECT date, won FROM game_results
+		WHERE user_id = ?
+		ORDER BY date ASC
+	`, userID)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer rows.Close()
+
+	var results []dayResult
+	for rows.Next() {
+		var r dayResult
+		if err := rows.Scan(&r.Date, &r.Won); err != nil {
+			return 0, 0, err
+		}
+		results = append(results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	current, longest = computeStreaks(results, playerToday(db, userID, time.Now()))
+	return current, longest, nil
+}
+
+// allCurrentStreaks returns every player's current streak, for the
+// leaderboard. It reads the streaks user_stats stored when each player's last
+// result came in: one still stands if that result was on the player's today
+// or yesterday, as computeStreaks would find.
+func allCurrentStreaks(now time.Time) (map[int64]int, error) {
+	offsets := map[int64]int{}
+	rows, err := db.Query(latestTzOffsetsSQL)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var userID int64
+		var offset int
+		if err := rows.Scan(&userID, &offset); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		offsets[userID] = offset
+	}
+	rows.Close()
+
+	rows, err = db.Query("SELECT user_id, current_streak, last_date FROM user_stats WHERE current_streak > 0 AND last_date IS NOT NULL")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	streaks := map[int64]int{}
+	for rows.Next() {
+		var userID int64
+		var streak int
+		var lastDate string
+		if err := rows.Scan(&userID, &streak, &lastDate); err != nil {
+			return nil, err
+		}
+		offset, ok := offsets[userID]
+		if !ok {
+			offset = unknownTzOffset
+		}
+		last, err := time.Parse(dateLayout, lastDate)
+		if err != nil {
+			continue
+		}
+		today, _ := time.Parse(dateLayout, localPuzzleDate(now, offset))
+		if today.Sub(last) <= 24*time.Hour {
+			streaks[userID] = streak
+		}
+	}
+	return streaks, rows.Err()
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestComputeStreaks(t *testing.T) {
+	wins := func(dates ...string) []dayResult {
+		var rs []dayResult
+		for _, d := range dates {
+			rs = append(rs, dayResult{Date: d, Won: true})
+		}
+		return rs
+	}
+	tests := []struct {
+		name             string
+		results          []dayResult
+		today            string
+		current, longest int
+	}{
+		{"no games", nil, "2024-03-10", 0, 0},
+		{"won today", wins("2024-03-08", "2024-03-09", "2024-03-10"), "2024-03-10", 3, 3},
+		{"won yesterday", wins("2024-03-08", "2024-03-09"), "2024-03-10", 2, 2},
+		{"last win two days ago", wins("2024-03-07", "2024-03-08"), "2024-03-10", 0, 2},
+		{"skipped day", wins("2024-03-05", "2024-03-06", "2024-03-07", "2024-03-09", "2024-03-10"), "2024-03-10", 2, 3},
+		{"loss in between", []dayResult{{"2024-03-08", true}, {"2024-03-09", false}, {"2024-03-10", true}}, "2024-03-10", 1, 1},
+		{"lost today", []dayResult{{"2024-03-09", true}, {"2024-03-10", false}}, "2024-03-10", 0, 1},
+		{"across a month end", wins("2024-02-28", "2024-02-29", "2024-03-01"), "2024-03-01", 3, 3},
+		{"unordered", wins("2024-03-10", "2024-03-08", "2024-03-09"), "2024-03-10", 3, 3},
+		{"invalid date ignored", wins("2024-03-09", "not-a-date", "2024-03-10"), "2024-03-10", 2, 2},
+		{"invalid today", wins("2024-03-09", "2024-03-10"), "", 0, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current, longest := computeStreaks(tt.results, tt.today)
+			if current != tt.current || longest != tt.longest {
+				t.Errorf("computeStreaks = %d, %d, want %d, %d", current, longest, tt.current, tt.longest)
+			}
+		})
+	}
+}
+
+func TestLocalPuzzleDate(t *testing.T) {
+	now := time.Date(2024, 3, 10, 11, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		now      time.Time
+		tzOffset int
+		want     string
+	}{
+		{"UTC", now, 0, "2024-03-10"},
+		{"UTC+14", now, -14 * 60, "2024-03-11"},
+		{"UTC-12", now, 12 * 60, "2024-03-09"},
+		{"UTC+5:30", now, -330, "2024-03-10"},
+		{"now in another zone", now.In(time.FixedZone("", 9*3600)), 0, "2024-03-10"},
+	}
+	for _, tt := range tests {
+		if got := localPuzzleDate(tt.now, tt.tzOffset); got != tt.want {
+			t.Errorf("%s: localPuzzleDate = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestStreakAtOffset checks that whether a streak is still alive depends on
+// the date at the player's own offset: at 06:00 UTC on the 11th it is already
+// the evening of the 11th at UTC+14 but still the 10th at UTC-12.
+func TestStreakAtOffset(t *testing.T) {
+	now := time.Date(2024, 3, 11, 6, 0, 0, 0, time.UTC)
+	tests := []struct {
+		lastWin  string
+		tzOffset int
+		want     int
+	}{
+		{"2024-03-10", -14 * 60, 1}, // yesterday
+		{"2024-03-10", 12 * 60, 1},  // today
+		{"2024-03-09", -14 * 60, 0}, // two days ago
+		{"2024-03-09", 12 * 60, 1},  // yesterday
+	}
+	for _, tt := range tests {
+		current, _ := computeStreaks([]dayResult{{tt.lastWin, true}}, localPuzzleDate(now, tt.tzOffset))
+		if current != tt.want {
+			t.Errorf("last win %s at offset %d: current = %d, want %d", tt.lastWin, tt.tzOffset, current, tt.want)
+		}
+	}
+}
+
+// TestPlayerTodayAgreesWithLeaderboard gives a player timezone events whose
+// ids run against their times, as after merging two accounts, and checks
+// that stats and the leaderboard both use the newest one.
+func TestPlayerTodayAgreesWithLeaderboard(t *testing.T) {
+	useTestDB(t)
+	now := time.Date(2024, 3, 11, 6, 0, 0, 0, time.UTC)
+	for _, q := range []string{
+		"INSERT INTO users (id, provider, provider_id, display_name) VALUES (1, 'github', '1', 'One')",
+		// Newest by time, lower id: UTC+14, where it is already the 11th
+		"INSERT INTO tz_events (id, user_id, server_utc, client_time, tz_offset, ip, endpoint) VALUES (1, 1, '2024-03-11T05:00:00Z', '', -840, '', 'guess')",
+		// Older, higher id: UTC-12, where it is still the 10th
+		"INSERT INTO tz_events (id, user_id, server_utc, client_time, tz_offset, ip, endpoint) VALUES (2, 1, '2024-03-09T05:00:00Z', '', 720, '', 'guess')",
+		"INSERT INTO game_results (user_id, date, won, guesses, hard_mode) VALUES (1, '2024-03-09', TRUE, 3, FALSE)",
+		// As refreshUserStats left it on the 9th
+		"INSERT INTO user_stats (user_id, played, won, current_streak, max_streak, last_date) VALUES (1, 1, 1, 1, 1, '2024-03-09')",
+		// Only ever at UTC-12, where the 9th is yesterday
+		"INSERT INTO users (id, provider, provider_id, display_name) VALUES (2, 'github', '2', 'Two')",
+		"INSERT INTO tz_events (id, user_id, server_utc, client_time, tz_offset, ip, endpoint) VALUES (3, 2, '2024-03-09T05:00:00Z', '', 720, '', 'guess')",
+		"INSERT INTO user_stats (user_id, played, won, current_streak, max_streak, last_date) VALUES (2, 1, 1, 1, 1, '2024-03-09')",
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+	}
+
+	if got := playerToday(db, 1, now); got != "2024-03-11" {
+		t.Errorf("playerToday = %s, want 2024-03-11", got)
+	}
+	streaks, err := allCurrentStreaks(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A win on the 9th is two days ago at UTC+14
+	if streaks[1] != 0 {
+		t.Errorf("leaderboard streak = %d, want 0", streaks[1])
+	}
+	if streaks[2] != 1 {
+		t.Errorf("leaderboard streak at UTC-12 = %d, want 1", streaks[2])
+	}
+}